@@ -1,27 +1,73 @@
 package main
 
 import (
+	"blog/api/internal/audit"
 	"blog/api/internal/config"
 	"blog/api/internal/database"
 	"blog/api/internal/firebase"
 	"blog/api/internal/handlers"
+	"blog/api/internal/logging"
+	"blog/api/internal/login"
+	"blog/api/internal/mailer"
+	"blog/api/internal/media"
+	"blog/api/internal/metrics"
 	"blog/api/internal/middleware"
-	"log"
+	"blog/api/internal/ratelimit"
+	"blog/api/internal/rbac"
+	"blog/api/internal/revocation"
+	"blog/api/internal/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
+	// Log JSON from the start so configuration warnings are structured too
+	slog.SetDefault(logging.New(os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL")))
+
 	// Load configuration
 	cfg := config.Load()
 
+	// Cancelled on SIGINT or SIGTERM, which stops background work and starts
+	// draining requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Install the tracer before any client is created so they pick it up
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		ServiceName: cfg.ServiceName,
+		Endpoint:    cfg.TracingEndpoint,
+		Insecure:    cfg.TracingInsecure,
+		Headers:     cfg.TracingHeaders,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+
 	// Initialize MongoDB
 	mongoDB, err := database.NewMongoDB(cfg.MongoDBURI)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		fatal("Failed to connect to MongoDB", err)
+	}
+	// Existing duplicates keep the unique media index from being built; the
+	// API still runs, but concurrent identical uploads may both be recorded
+	indexCtx, cancelIndexes := context.WithTimeout(ctx, time.Minute)
+	if err := mongoDB.EnsureIndexes(indexCtx); err != nil {
+		slog.Error("Failed to create MongoDB indexes", "error", err)
 	}
-	defer mongoDB.Disconnect()
+	cancelIndexes()
 
 	// Initialize Firebase
 	fb, err := firebase.NewFirebase(
@@ -30,70 +76,302 @@ func main() {
 		cfg.FirebaseStorageBucket,
 	)
 	if err != nil {
-		log.Fatalf("Failed to initialize Firebase: %v", err)
+		fatal("Failed to initialize Firebase", err)
+	}
+
+	// Seed the admin allowlist from ADMIN_EMAILS on first boot
+	normalized, err := fb.NormalizeUserEmails(ctx)
+	if err != nil {
+		fatal("Failed to normalize user emails", err)
+	}
+	if normalized > 0 {
+		slog.Info("Lowercased stored user emails", "count", normalized)
+	}
+
+	seeded, err := fb.SeedAdmins(ctx, cfg.AdminEmails, cfg.AdminRole)
+	if err != nil {
+		fatal("Failed to seed admin users", err)
+	}
+	if seeded > 0 {
+		slog.Info("Seeded admin users from ADMIN_EMAILS", "count", seeded)
+	}
+
+	// Users from before roles existed had full access; keep it that way
+	assigned, err := fb.AssignMissingRoles(ctx, cfg.AdminRole)
+	if err != nil {
+		fatal("Failed to assign roles to existing users", err)
+	}
+	if assigned > 0 {
+		slog.Info("Assigned roles to users without one", "count", assigned, "role", cfg.AdminRole)
+	}
+
+	// Load the access token revocation list
+	revocations := revocation.NewList(fb)
+	if err := revocations.Start(ctx); err != nil {
+		fatal("Failed to load token revocations", err)
+	}
+
+	// Initialize mailer
+	mail, err := mailer.New(mailer.Config{
+		Driver:       cfg.MailDriver,
+		From:         cfg.MailFrom,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+		Dir:          cfg.MailDir,
+	})
+	if err != nil {
+		fatal("Failed to initialize mailer", err)
+	}
+
+	// Login providers; Google is always available
+	providers := []login.Provider{login.NewGoogleProvider(cfg.GoogleClientID)}
+	for _, oidcConfig := range cfg.OIDCProviders {
+		provider, err := login.NewOIDCProvider(context.Background(), oidcConfig)
+		if err != nil {
+			fatal("Failed to initialize login provider", err)
+		}
+		providers = append(providers, provider)
+	}
+
+	// Passkey relying party
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnOrigins,
+	})
+	if err != nil {
+		fatal("Failed to initialize WebAuthn", err)
 	}
-	defer fb.Close()
 
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	router.Use(otelgin.Middleware(cfg.ServiceName), middleware.RequestID(), middleware.RequestLogger(), middleware.Metrics(), middleware.Recovery())
 
 	// CORS configuration
 	corsConfig := cors.Config{
 		AllowOrigins:     []string{cfg.FrontendURL},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Upload-Offset", middleware.CSRFHeader, middleware.RequestIDHeader, "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"Location", "Upload-Offset", middleware.RequestIDHeader, "Retry-After", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
 		AllowCredentials: true,
 	}
 	router.Use(cors.New(corsConfig))
 
 	// Initialize handlers
+	auditLog := audit.NewLog(mongoDB)
 	healthHandler := handlers.NewHealthHandler()
-	authHandler := handlers.NewAuthHandler(cfg, fb)
-	postsHandler := handlers.NewPostsHandler(mongoDB)
-	aboutHandler := handlers.NewAboutHandler(mongoDB)
-	uploadsHandler := handlers.NewUploadsHandler(fb)
+	authHandler := handlers.NewAuthHandler(cfg, fb, revocations, login.NewRegistry(providers...), auditLog)
+	mediaStore := media.NewStore(mongoDB, fb, cfg.APIURL, cfg.MediaURLSecret)
+	postsHandler := handlers.NewPostsHandler(mongoDB, mediaStore, auditLog)
+	aboutHandler := handlers.NewAboutHandler(mongoDB, auditLog)
+	uploadsHandler := handlers.NewUploadsHandler(mediaStore, auditLog)
+	mediaCollector := media.NewCollector(mediaStore, cfg.MediaGCQuarantine, cfg.MediaGCMinAge)
+	mediaHandler := handlers.NewMediaHandler(mongoDB, fb, mediaStore, mediaCollector, auditLog)
+	mfaHandler := handlers.NewMFAHandler(cfg, fb, revocations, authHandler)
+	webauthnHandler := handlers.NewWebAuthnHandler(fb, wa, authHandler)
+	accessTokensHandler := handlers.NewAccessTokensHandler(fb, auditLog)
+	usersHandler := handlers.NewUsersHandler(fb, revocations, auditLog)
+	invitationsHandler := handlers.NewInvitationsHandler(cfg, fb, mail, auditLog)
+	auditHandler := handlers.NewAuditHandler(auditLog)
+
+	// Periodically collect orphaned uploads
+	if cfg.MediaGCInterval > 0 {
+		go mediaCollector.Start(ctx, cfg.MediaGCInterval)
+	}
+
+	// Discard resumable uploads that expired before completing, along with
+	// their chunks, whether or not garbage collection is enabled
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := mediaStore.CleanupExpiredSessions(ctx); err != nil {
+					slog.Error("Failed to clean up expired upload sessions", "error", err)
+				}
+			}
+		}
+	}()
+
+	// Remove passkey ceremonies that were begun but never finished
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := fb.DeleteExpiredWebAuthnCeremonies(ctx); err != nil {
+					slog.Error("Failed to delete expired WebAuthn ceremonies", "error", err)
+				}
+			}
+		}
+	}()
+
+	requireAuth := middleware.AuthMiddleware(cfg, revocations, fb)
+	// Account management needs an interactive login, not a personal access
+	// token
+	requireSession := middleware.RequireSession()
+
+	// Throttle the routes most worth abusing: logins, search and uploads
+	rateLimits := ratelimit.NewMemoryStore()
+	limitAuth := middleware.RateLimit(rateLimits, "auth", cfg.RateLimitAuth)
+	limitSearch := middleware.RateLimit(rateLimits, "search", cfg.RateLimitSearch)
+	limitUploads := middleware.RateLimit(rateLimits, "uploads", cfg.RateLimitUploads)
 
 	// Health check route
 	router.GET("/health", healthHandler.HealthCheck)
 
+	// Prometheus metrics, for scrapers holding METRICS_TOKEN if one is set
+	router.GET("/metrics", middleware.RequireBearerToken(cfg.MetricsToken), gin.WrapH(metrics.Handler()))
+
+	// Public keys for verifying our tokens
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Auth routes
 	authRoutes := router.Group("/auth")
 	{
-		authRoutes.POST("/google", authHandler.GoogleLogin)
-		authRoutes.POST("/refresh", authHandler.RefreshToken)
-		authRoutes.GET("/me", middleware.AuthMiddleware(cfg), authHandler.GetMe)
-		authRoutes.POST("/logout", middleware.AuthMiddleware(cfg), authHandler.Logout)
+		authRoutes.GET("/providers", authHandler.ListProviders)
+		authRoutes.POST("/google", limitAuth, authHandler.GoogleLogin)
+		authRoutes.POST("/login/:provider", limitAuth, authHandler.Login)
+		authRoutes.POST("/refresh", limitAuth, authHandler.RefreshToken)
+		authRoutes.GET("/me", requireAuth, authHandler.GetMe)
+		authRoutes.POST("/logout", requireAuth, requireSession, authHandler.Logout)
+		authRoutes.POST("/logout-all", requireAuth, requireSession, authHandler.LogoutAll)
+		authRoutes.GET("/sessions", requireAuth, requireSession, authHandler.ListSessions)
+		authRoutes.DELETE("/sessions/:id", requireAuth, requireSession, authHandler.DeleteSession)
+		authRoutes.POST("/mfa/verify", limitAuth, mfaHandler.Verify)
+		authRoutes.GET("/mfa", requireAuth, requireSession, mfaHandler.GetStatus)
+		authRoutes.POST("/mfa/totp/enroll", requireAuth, requireSession, mfaHandler.EnrollTOTP)
+		authRoutes.POST("/mfa/totp/confirm", requireAuth, requireSession, mfaHandler.ConfirmTOTP)
+		authRoutes.DELETE("/mfa/totp", requireAuth, requireSession, mfaHandler.DisableTOTP)
+		authRoutes.POST("/mfa/recovery-codes", requireAuth, requireSession, mfaHandler.RegenerateRecoveryCodes)
+		authRoutes.POST("/webauthn/register/begin", requireAuth, requireSession, webauthnHandler.BeginRegistration)
+		authRoutes.POST("/webauthn/register/finish", requireAuth, requireSession, webauthnHandler.FinishRegistration)
+		authRoutes.POST("/webauthn/login/begin", limitAuth, webauthnHandler.BeginLogin)
+		authRoutes.POST("/webauthn/login/finish", limitAuth, webauthnHandler.FinishLogin)
+		authRoutes.GET("/webauthn/credentials", requireAuth, requireSession, webauthnHandler.ListPasskeys)
+		authRoutes.DELETE("/webauthn/credentials/:id", requireAuth, requireSession, webauthnHandler.DeletePasskey)
+		authRoutes.GET("/tokens", requireAuth, requireSession, accessTokensHandler.ListAccessTokens)
+		authRoutes.POST("/tokens", requireAuth, requireSession, accessTokensHandler.CreateAccessToken)
+		authRoutes.DELETE("/tokens/:id", requireAuth, requireSession, accessTokensHandler.DeleteAccessToken)
 	}
 
 	// Posts routes
 	postsRoutes := router.Group("/posts")
 	{
 		postsRoutes.GET("", postsHandler.GetPosts)
-		postsRoutes.GET("/search", postsHandler.SearchPosts)
+		postsRoutes.GET("/search", limitSearch, postsHandler.SearchPosts)
 		postsRoutes.GET("/:id", postsHandler.GetPost)
-		postsRoutes.GET("/admin/:id", middleware.AuthMiddleware(cfg), postsHandler.GetPostAdmin)
-		postsRoutes.POST("", middleware.AuthMiddleware(cfg), postsHandler.CreatePost)
-		postsRoutes.PUT("/:id", middleware.AuthMiddleware(cfg), postsHandler.UpdatePost)
-		postsRoutes.DELETE("/:id", middleware.AuthMiddleware(cfg), postsHandler.DeletePost)
+		postsRoutes.GET("/admin/:id", requireAuth, postsHandler.GetPostAdmin)
+		postsRoutes.POST("", requireAuth, middleware.RequirePermission(rbac.CreatePosts), postsHandler.CreatePost)
+		postsRoutes.PUT("/:id", requireAuth, middleware.RequirePermission(rbac.CreatePosts), postsHandler.UpdatePost)
+		postsRoutes.DELETE("/:id", requireAuth, middleware.RequirePermission(rbac.CreatePosts), postsHandler.DeletePost)
 	}
 
 	// About routes
 	aboutRoutes := router.Group("/about")
 	{
 		aboutRoutes.GET("", aboutHandler.GetAbout)
-		aboutRoutes.PUT("", middleware.AuthMiddleware(cfg), aboutHandler.UpdateAbout)
+		aboutRoutes.PUT("", requireAuth, middleware.RequirePermission(rbac.EditAbout), aboutHandler.UpdateAbout)
 	}
 
 	// Uploads routes
-	uploadsRoutes := router.Group("/uploads")
+	uploadsRoutes := router.Group("/uploads", requireAuth, middleware.RequirePermission(rbac.UploadMedia))
 	{
-		uploadsRoutes.POST("/image", middleware.AuthMiddleware(cfg), uploadsHandler.UploadImage)
+		uploadsRoutes.POST("/image", limitUploads, uploadsHandler.UploadImage)
+		uploadsRoutes.POST("/from-url", limitUploads, uploadsHandler.UploadImageFromURL)
+		uploadsRoutes.POST("/sessions", uploadsHandler.CreateUploadSession)
+		uploadsRoutes.GET("/sessions/:id", uploadsHandler.GetUploadSession)
+		uploadsRoutes.PATCH("/sessions/:id", uploadsHandler.AppendUploadChunk)
+		uploadsRoutes.POST("/sessions/:id/complete", uploadsHandler.CompleteUploadSession)
+		uploadsRoutes.DELETE("/sessions/:id", uploadsHandler.AbortUploadSession)
+	}
+
+	// Media library routes
+	mediaRoutes := router.Group("/media")
+	{
+		mediaRoutes.GET("", requireAuth, middleware.RequirePermission(rbac.UploadMedia), mediaHandler.ListMedia)
+		mediaRoutes.GET("/gc/report", requireAuth, middleware.RequirePermission(rbac.ManageMedia), mediaHandler.GetGCReport)
+		mediaRoutes.POST("/gc", requireAuth, middleware.RequirePermission(rbac.ManageMedia), mediaHandler.RunGC)
+		mediaRoutes.POST("/placeholders/backfill", requireAuth, middleware.RequirePermission(rbac.ManageMedia), mediaHandler.BackfillPlaceholders)
+		mediaRoutes.GET("/:id", requireAuth, middleware.RequirePermission(rbac.UploadMedia), mediaHandler.GetMedia)
+		mediaRoutes.GET("/file/*path", mediaHandler.ServeFile)
+		mediaRoutes.POST("/:id/signed-url", requireAuth, middleware.RequirePermission(rbac.UploadMedia), mediaHandler.CreateSignedURL)
+		mediaRoutes.PUT("/:id", requireAuth, middleware.RequirePermission(rbac.ManageMedia), mediaHandler.UpdateMedia)
+		mediaRoutes.DELETE("/:id", requireAuth, middleware.RequirePermission(rbac.ManageMedia), mediaHandler.DeleteMedia)
+	}
+
+	// Admin routes
+	adminRoutes := router.Group("/admin", requireAuth, middleware.RequirePermission(rbac.ManageUsers))
+	{
+		adminRoutes.GET("/users", usersHandler.ListUsers)
+		adminRoutes.POST("/users", usersHandler.InviteUser)
+		adminRoutes.POST("/users/:id/disable", usersHandler.DisableUser)
+		adminRoutes.POST("/users/:id/enable", usersHandler.EnableUser)
+		adminRoutes.GET("/invitations", invitationsHandler.ListInvitations)
+		adminRoutes.POST("/invitations", invitationsHandler.CreateInvitation)
+		adminRoutes.DELETE("/invitations/:id", invitationsHandler.DeleteInvitation)
+		adminRoutes.PUT("/users/:id/role", usersHandler.UpdateUserRole)
+		adminRoutes.GET("/audit", middleware.RequirePermission(rbac.ViewAuditLog), auditHandler.ListEntries)
+		adminRoutes.GET("/audit/export", middleware.RequirePermission(rbac.ViewAuditLog), auditHandler.ExportEntries)
 	}
 
 	// Start server
-	port := ":" + cfg.Port
-	log.Printf("Server starting on port %s", cfg.Port)
-	if err := router.Run(port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
 	}
+	go func() {
+		slog.Info("Server starting", "port", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
+		}
+	}()
+
+	<-ctx.Done()
+	// A second signal kills the process without waiting
+	stop()
+	slog.Info("Shutting down", "drainTimeout", cfg.ShutdownTimeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and wait for requests in flight, then close
+	// the clients they use. Spans are flushed last so shutdown is traced too.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Requests did not drain in time, closing their connections", "error", err)
+		server.Close()
+	}
+	if err := fb.Close(); err != nil {
+		slog.Error("Failed to close Firebase", "error", err)
+	}
+	if err := mongoDB.Disconnect(shutdownCtx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs a startup failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
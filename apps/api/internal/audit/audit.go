@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"blog/api/internal/database"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Log records admin actions in the auditLog collection. Recording never fails
+// the action being audited; errors are only logged.
+type Log struct {
+	db *database.MongoDB
+}
+
+func NewLog(db *database.MongoDB) *Log {
+	return &Log{db: db}
+}
+
+// recordTimeout bounds storing a single entry
+const recordTimeout = 5 * time.Second
+
+// Filter narrows down audit log queries. Zero fields match everything.
+type Filter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+}
+
+// Record stores entry, filling in the actor from the authenticated request
+// unless the caller set it, and the request's IP and user agent. The action
+// has already happened, so the entry is stored even if the client has gone.
+func (l *Log) Record(c *gin.Context, entry models.AuditEntry) {
+	if entry.ActorID == "" {
+		entry.ActorID, _ = middleware.GetUserID(c)
+		entry.ActorEmail, _ = middleware.GetUserEmail(c)
+	}
+	entry.IP = c.ClientIP()
+	entry.UserAgent = c.Request.UserAgent()
+	entry.CreatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), recordTimeout)
+	defer cancel()
+
+	if _, err := l.db.AuditLog().InsertOne(ctx, entry); err != nil {
+		middleware.GetLogger(c).Error("Failed to record audit entry", "action", entry.Action, "actorId", entry.ActorID, "error", err)
+	}
+}
+
+// Find returns a page of entries matching filter, newest first, and the total
+// number of matches.
+func (l *Log) Find(ctx context.Context, filter Filter, page, limit int) ([]models.AuditEntry, int64, error) {
+	query := filter.query()
+
+	total, err := l.db.AuditLog().CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := l.db.AuditLog().Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// Export writes every entry matching filter to w as JSON Lines, oldest first,
+// without loading them all into memory.
+func (l *Log) Export(ctx context.Context, filter Filter, w io.Writer) error {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := l.db.AuditLog().Find(ctx, filter.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	encoder := json.NewEncoder(w)
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if f.ActorID != "" {
+		query["actorId"] = f.ActorID
+	}
+	if f.Action != "" {
+		query["action"] = f.Action
+	}
+	if f.TargetType != "" {
+		query["targetType"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		query["targetId"] = f.TargetID
+	}
+
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = f.To
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+
+	return query
+}
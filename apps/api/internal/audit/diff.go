@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"blog/api/internal/models"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// maxValueLength caps how much of a long value, such as post content, is kept
+// in a change summary.
+const maxValueLength = 200
+
+// Diff compares the JSON representations of before and after and returns the
+// fields that differ. Either may be nil, for creations and deletions. Fields
+// in ignore, such as timestamps, are skipped.
+func Diff(before, after interface{}, ignore ...string) []models.FieldChange {
+	old := toMap(before)
+	updated := toMap(after)
+
+	skip := map[string]bool{}
+	for _, field := range ignore {
+		skip[field] = true
+	}
+
+	fields := []string{}
+	for field := range old {
+		fields = append(fields, field)
+	}
+	for field := range updated {
+		if _, ok := old[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, field := range fields {
+		if skip[field] || reflect.DeepEqual(old[field], updated[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{
+			Field: field,
+			Old:   summarize(old[field]),
+			New:   summarize(updated[field]),
+		})
+	}
+	return changes
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(data, &m)
+	return m
+}
+
+func summarize(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	runes := []rune(s)
+	if len(runes) <= maxValueLength {
+		return s
+	}
+	return string(runes[:maxValueLength]) + "…"
+}
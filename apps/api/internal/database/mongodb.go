@@ -1,12 +1,16 @@
 package database
 
 import (
+	"blog/api/internal/metrics"
 	"context"
-	"log"
+	"log/slog"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 type MongoDB struct {
@@ -18,7 +22,7 @@ func NewMongoDB(uri string) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	clientOptions := options.Client().ApplyURI(uri)
+	clientOptions := options.Client().ApplyURI(uri).SetMonitor(commandMonitor())
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, err
@@ -30,7 +34,7 @@ func NewMongoDB(uri string) (*MongoDB, error) {
 		return nil, err
 	}
 
-	log.Println("Connected to MongoDB!")
+	slog.Info("Connected to MongoDB")
 
 	database := client.Database("blog")
 
@@ -40,9 +44,46 @@ func NewMongoDB(uri string) (*MongoDB, error) {
 	}, nil
 }
 
-func (m *MongoDB) Disconnect() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// commandMonitor records the latency of every command the driver sends and
+// traces it as a child of the span in the command's context.
+func commandMonitor() *event.CommandMonitor {
+	tracing := otelmongo.NewMonitor()
+	return &event.CommandMonitor{
+		Started: tracing.Started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			tracing.Succeeded(ctx, e)
+			metrics.ObserveMongoCommand(e.CommandName, metrics.StatusOK, e.Duration)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			tracing.Failed(ctx, e)
+			metrics.ObserveMongoCommand(e.CommandName, metrics.StatusError, e.Duration)
+		},
+	}
+}
+
+// EnsureIndexes creates the indexes the API relies on for correctness.
+func (m *MongoDB) EnsureIndexes(ctx context.Context) error {
+	// One live media entry per content hash and visibility, so concurrent
+	// identical uploads cannot both be recorded. Quarantined entries are
+	// skipped when deduplicating and may coexist with a live one; entries
+	// from before hashing have an empty hash and are left out.
+	_, err := m.Media().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "hash", Value: 1},
+			{Key: "visibility", Value: 1},
+			{Key: "quarantinedAt", Value: 1},
+		},
+		Options: options.Index().
+			SetName("hash_visibility_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"hash": bson.M{"$gt": ""}}),
+	})
+	return err
+}
+
+// Disconnect waits for operations in progress to finish and closes the
+// connection pool, giving up when ctx ends.
+func (m *MongoDB) Disconnect(ctx context.Context) error {
 	return m.Client.Disconnect(ctx)
 }
 
@@ -53,3 +94,15 @@ func (m *MongoDB) Posts() *mongo.Collection {
 func (m *MongoDB) Abouts() *mongo.Collection {
 	return m.Database.Collection("abouts")
 }
+
+func (m *MongoDB) Media() *mongo.Collection {
+	return m.Database.Collection("media")
+}
+
+func (m *MongoDB) UploadSessions() *mongo.Collection {
+	return m.Database.Collection("uploadSessions")
+}
+
+func (m *MongoDB) AuditLog() *mongo.Collection {
+	return m.Database.Collection("auditLog")
+}
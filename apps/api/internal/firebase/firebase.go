@@ -1,20 +1,35 @@
 package firebase
 
 import (
+	"blog/api/internal/metrics"
+	"blog/api/internal/models"
+	"blog/api/internal/tracing"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"mime/multipart"
+	"log/slog"
+	"net/http"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go/v4"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 type Firebase struct {
@@ -31,6 +46,17 @@ func NewFirebase(projectID, serviceAccountJSON, storageBucket string) (*Firebase
 	var app *firebase.App
 	var err error
 
+	// Firestore calls go through these interceptors to record their latency,
+	// and are traced by the stats handler. The revocation watch is a stream
+	// that stays open for the life of the process, so it is not traced.
+	instrumented := option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(metrics.FirestoreUnaryInterceptor))
+	instrumentedStreams := option.WithGRPCDialOption(grpc.WithChainStreamInterceptor(metrics.FirestoreStreamInterceptor))
+	traced := option.WithGRPCDialOption(grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+		otelgrpc.WithFilter(func(info *stats.RPCTagInfo) bool {
+			return !strings.HasSuffix(info.FullMethodName, "/Listen")
+		}),
+	)))
+
 	if serviceAccountJSON != "" {
 		// Production mode with service account
 		opt := option.WithCredentialsJSON([]byte(serviceAccountJSON))
@@ -38,14 +64,14 @@ func NewFirebase(projectID, serviceAccountJSON, storageBucket string) (*Firebase
 			ProjectID:     projectID,
 			StorageBucket: storageBucket,
 		}
-		app, err = firebase.NewApp(ctx, config, opt)
+		app, err = firebase.NewApp(ctx, config, opt, instrumented, instrumentedStreams, traced)
 	} else {
 		// Development mode
 		config := &firebase.Config{
 			ProjectID:     projectID,
 			StorageBucket: storageBucket,
 		}
-		app, err = firebase.NewApp(ctx, config)
+		app, err = firebase.NewApp(ctx, config, instrumented, instrumentedStreams, traced)
 	}
 
 	if err != nil {
@@ -71,7 +97,7 @@ func NewFirebase(projectID, serviceAccountJSON, storageBucket string) (*Firebase
 
 	bucket := storageClient.Bucket(storageBucket)
 
-	log.Println("Connected to Firebase!")
+	slog.Info("Connected to Firebase")
 
 	return &Firebase{
 		App:           app,
@@ -82,14 +108,21 @@ func NewFirebase(projectID, serviceAccountJSON, storageBucket string) (*Firebase
 	}, nil
 }
 
+// Close closes the Firestore and Storage clients. Calls still in flight fail,
+// so it must only be called once requests have drained.
 func (f *Firebase) Close() error {
+	var errs []error
 	if f.Firestore != nil {
-		f.Firestore.Close()
+		if err := f.Firestore.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing firestore: %v", err))
+		}
 	}
 	if f.StorageClient != nil {
-		f.StorageClient.Close()
+		if err := f.StorageClient.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing storage: %v", err))
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // User operations
@@ -106,54 +139,851 @@ func (f *Firebase) CreateOrUpdateUser(ctx context.Context, userID string, data m
 	return err
 }
 
-// Refresh token operations
-func (f *Firebase) SaveRefreshToken(ctx context.Context, userID, token string) error {
-	data := map[string]interface{}{
-		"token":     token,
-		"userId":    userID,
-		"createdAt": time.Now(),
+// ListUsers returns every user, ordered by email.
+func (f *Firebase) ListUsers(ctx context.Context) ([]models.User, error) {
+	docs, err := f.Firestore.Collection("users").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	users := []models.User{}
+	for _, doc := range docs {
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return nil, err
+		}
+		user.ID = doc.Ref.ID
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+
+	return users, nil
+}
+
+// CountUsersWithRole counts the active users holding role.
+func (f *Firebase) CountUsersWithRole(ctx context.Context, role string) (int, error) {
+	docs, err := f.Firestore.Collection("users").Where("role", "==", role).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, doc := range docs {
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return 0, err
+		}
+		if user.IsActive() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+var ErrUserNotFound = errors.New("user not found")
+
+// FindUserByEmail returns the user entry for email, including invited ones.
+func (f *Firebase) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	docs, err := f.Firestore.Collection("users").Where("email", "==", strings.ToLower(email)).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	var user models.User
+	if err := docs[0].DataTo(&user); err != nil {
+		return nil, err
+	}
+	user.ID = docs[0].Ref.ID
+	return &user, nil
+}
+
+// InviteUser adds email to the allowlist. The entry gets a generated ID
+// until the user logs in and it is replaced by their account.
+func (f *Firebase) InviteUser(ctx context.Context, email, role string) (*models.User, error) {
+	user := models.User{
+		Email:     strings.ToLower(email),
+		Role:      role,
+		Status:    models.UserInvited,
+		CreatedAt: time.Now(),
+	}
+
+	ref, _, err := f.Firestore.Collection("users").Add(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = ref.ID
+	return &user, nil
+}
+
+func (f *Firebase) DeleteUser(ctx context.Context, userID string) error {
+	_, err := f.Firestore.Collection("users").Doc(userID).Delete(ctx)
+	return err
+}
+
+// NormalizeUserEmails lowercases stored emails, which older logins saved as
+// the provider returned them, so FindUserByEmail matches every user. It
+// returns the number of users updated.
+func (f *Firebase) NormalizeUserEmails(ctx context.Context) (int, error) {
+	users, err := f.ListUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	normalized := 0
+	for _, user := range users {
+		email := strings.ToLower(user.Email)
+		if email == user.Email {
+			continue
+		}
+		if err := f.CreateOrUpdateUser(ctx, user.ID, map[string]interface{}{"email": email}); err != nil {
+			return normalized, err
+		}
+		normalized++
+	}
+	return normalized, nil
+}
+
+// SeedAdmins invites the given emails with role on first boot and disables
+// existing users that are not among them, matching what the env allowlist
+// allowed. Later boots leave the users store alone so changes made through
+// the API are kept.
+func (f *Firebase) SeedAdmins(ctx context.Context, emails []string, role string) (int, error) {
+	marker := f.Firestore.Collection("meta").Doc("adminSeed")
+	if _, err := marker.Get(ctx); err == nil {
+		return 0, nil
+	} else if status.Code(err) != codes.NotFound {
+		return 0, err
+	}
+
+	allowed := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		allowed[strings.ToLower(email)] = true
+	}
+
+	users, err := f.ListUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, user := range users {
+		if user.IsActive() && !allowed[strings.ToLower(user.Email)] {
+			err := f.CreateOrUpdateUser(ctx, user.ID, map[string]interface{}{
+				"status": models.UserDisabled,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	seeded := 0
+	for _, email := range emails {
+		if email == "" {
+			continue
+		}
+		_, err := f.FindUserByEmail(ctx, email)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return seeded, err
+		}
+		if _, err := f.InviteUser(ctx, email, role); err != nil {
+			return seeded, err
+		}
+		seeded++
+	}
+
+	_, err = marker.Set(ctx, map[string]interface{}{
+		"seededAt": time.Now(),
+		"emails":   emails,
+	})
+	return seeded, err
+}
+
+// AssignMissingRoles gives role to every user without one that is not
+// disabled. Such users were admins, or allowlisted to become admins, before
+// roles existed, when everyone had full access. It returns the number of
+// users updated.
+func (f *Firebase) AssignMissingRoles(ctx context.Context, role string) (int, error) {
+	users, err := f.ListUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+	for _, user := range users {
+		if user.Role != "" || user.Status == models.UserDisabled {
+			continue
+		}
+		if err := f.CreateOrUpdateUser(ctx, user.ID, map[string]interface{}{"role": role}); err != nil {
+			return assigned, err
+		}
+		assigned++
+	}
+	return assigned, nil
+}
+
+// ClaimFirstOwner makes userID the owner if there is none yet and reports
+// whether it did. The check and the claim happen in one transaction on a
+// marker document, so of two concurrent first logins only one wins.
+func (f *Firebase) ClaimFirstOwner(ctx context.Context, userID string) (bool, error) {
+	marker := f.Firestore.Collection("meta").Doc("firstOwner")
+	claimed := false
+
+	err := f.Firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+
+		if _, err := tx.Get(marker); err == nil {
+			return nil
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		// Owners from before the marker existed count too
+		owners, err := tx.Documents(f.Firestore.Collection("users").Where("role", "==", models.RoleOwner).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(owners) > 0 {
+			return tx.Create(marker, map[string]interface{}{"userId": owners[0].Ref.ID, "claimedAt": time.Now()})
+		}
+
+		if err := tx.Create(marker, map[string]interface{}{"userId": userID, "claimedAt": time.Now()}); err != nil {
+			return err
+		}
+		claimed = true
+		return tx.Set(f.Firestore.Collection("users").Doc(userID), map[string]interface{}{"role": models.RoleOwner}, firestore.MergeAll)
+	})
+	return claimed, err
+}
+
+// Invitation operations
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationExpired  = errors.New("invitation has expired")
+	ErrInvitationUsed     = errors.New("invitation has already been used")
+	ErrInvitationEmail    = errors.New("invitation was sent to a different email")
+)
+
+// CreateInvitation stores invitation under the hash of its token.
+func (f *Firebase) CreateInvitation(ctx context.Context, tokenHash string, invitation models.Invitation) error {
+	_, err := f.Firestore.Collection("invitations").Doc(tokenHash).Create(ctx, invitation)
+	return err
+}
+
+// ListInvitations returns invitations that have been neither accepted nor
+// expired, newest first.
+func (f *Firebase) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	docs, err := f.Firestore.Collection("invitations").Where("expiresAt", ">", time.Now()).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := []models.Invitation{}
+	for _, doc := range docs {
+		var invitation models.Invitation
+		if err := doc.DataTo(&invitation); err != nil {
+			return nil, err
+		}
+		if invitation.AcceptedAt != nil {
+			continue
+		}
+		invitation.ID = doc.Ref.ID
+		invitations = append(invitations, invitation)
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].CreatedAt.After(invitations[j].CreatedAt)
+	})
+
+	return invitations, nil
+}
+
+func (f *Firebase) DeleteInvitation(ctx context.Context, id string) error {
+	ref := f.Firestore.Collection("invitations").Doc(id)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return ErrInvitationNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+// AcceptInvitation marks the invitation stored under tokenHash as used by
+// userID. It can only succeed once, and only for the invited email.
+func (f *Firebase) AcceptInvitation(ctx context.Context, tokenHash, email, userID string) (*models.Invitation, error) {
+	ref := f.Firestore.Collection("invitations").Doc(tokenHash)
+
+	var invitation models.Invitation
+	err := f.Firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrInvitationNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := doc.DataTo(&invitation); err != nil {
+			return err
+		}
+
+		switch {
+		case invitation.AcceptedAt != nil:
+			return ErrInvitationUsed
+		case time.Now().After(invitation.ExpiresAt):
+			return ErrInvitationExpired
+		case !strings.EqualFold(invitation.Email, email):
+			return ErrInvitationEmail
+		}
+
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		invitation.AcceptedBy = userID
+		return tx.Set(ref, invitation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.ID = tokenHash
+	return &invitation, nil
+}
+
+// Passkey operations
+var (
+	ErrPasskeyNotFound  = errors.New("passkey not found")
+	ErrCeremonyNotFound = errors.New("webauthn ceremony not found")
+	ErrCeremonyExpired  = errors.New("webauthn ceremony has expired")
+	ErrCeremonyMismatch = errors.New("webauthn ceremony belongs to another user")
+)
+
+// EnsureWebAuthnID returns the passkey user handle of a user, generating it
+// on first use.
+func (f *Firebase) EnsureWebAuthnID(ctx context.Context, userID string, generate func() ([]byte, error)) ([]byte, error) {
+	ref := f.Firestore.Collection("users").Doc(userID)
+
+	var handle []byte
+	err := f.Firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if len(user.WebAuthnID) > 0 {
+			handle = user.WebAuthnID
+			return nil
+		}
+
+		handle, err = generate()
+		if err != nil {
+			return err
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "webauthnId", Value: handle}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// FindUserByWebAuthnID returns the user a passkey user handle belongs to.
+func (f *Firebase) FindUserByWebAuthnID(ctx context.Context, handle []byte) (*models.User, error) {
+	docs, err := f.Firestore.Collection("users").Where("webauthnId", "==", handle).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	var user models.User
+	if err := docs[0].DataTo(&user); err != nil {
+		return nil, err
+	}
+	user.ID = docs[0].Ref.ID
+	return &user, nil
+}
+
+// ListPasskeys returns the passkeys of a user, oldest first.
+func (f *Firebase) ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error) {
+	docs, err := f.Firestore.Collection("users").Doc(userID).Collection("passkeys").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := []models.Passkey{}
+	for _, doc := range docs {
+		var passkey models.Passkey
+		if err := doc.DataTo(&passkey); err != nil {
+			return nil, err
+		}
+		passkey.ID = doc.Ref.ID
+		passkeys = append(passkeys, passkey)
+	}
+
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreatedAt.Before(passkeys[j].CreatedAt)
+	})
+
+	return passkeys, nil
+}
+
+func (f *Firebase) SavePasskey(ctx context.Context, userID string, passkey models.Passkey) error {
+	_, err := f.Firestore.Collection("users").Doc(userID).Collection("passkeys").Doc(passkey.ID).Set(ctx, passkey)
+	return err
+}
+
+func (f *Firebase) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	ref := f.Firestore.Collection("users").Doc(userID).Collection("passkeys").Doc(passkeyID)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return ErrPasskeyNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+// CreateWebAuthnCeremony stores the challenge of a ceremony under its ID.
+func (f *Firebase) CreateWebAuthnCeremony(ctx context.Context, ceremony models.WebAuthnCeremony) error {
+	_, err := f.Firestore.Collection("webauthnCeremonies").Doc(ceremony.ID).Create(ctx, ceremony)
+	return err
+}
+
+// TakeWebAuthnCeremony returns a ceremony of the given kind and deletes it, so
+// a challenge can only be answered once. userID must match for registrations.
+func (f *Firebase) TakeWebAuthnCeremony(ctx context.Context, id, kind, userID string) (*models.WebAuthnCeremony, error) {
+	ref := f.Firestore.Collection("webauthnCeremonies").Doc(id)
+
+	var ceremony models.WebAuthnCeremony
+	err := f.Firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrCeremonyNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := doc.DataTo(&ceremony); err != nil {
+			return err
+		}
+		if ceremony.Kind != kind {
+			return ErrCeremonyNotFound
+		}
+		if ceremony.UserID != userID {
+			return ErrCeremonyMismatch
+		}
+
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(ceremony.ExpiresAt) {
+		return nil, ErrCeremonyExpired
+	}
+
+	ceremony.ID = id
+	return &ceremony, nil
+}
+
+// DeleteExpiredWebAuthnCeremonies removes ceremonies that were never finished.
+func (f *Firebase) DeleteExpiredWebAuthnCeremonies(ctx context.Context) (int, error) {
+	docs, err := f.Firestore.Collection("webauthnCeremonies").Where("expiresAt", "<", time.Now()).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return i, err
+		}
+	}
+
+	return len(docs), nil
+}
+
+// MFA operations
+var ErrTOTPNotFound = errors.New("totp is not enrolled")
+
+func (f *Firebase) totpRef(userID string) *firestore.DocumentRef {
+	return f.Firestore.Collection("users").Doc(userID).Collection("mfa").Doc("totp")
+}
+
+func (f *Firebase) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	doc, err := f.totpRef(userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var totp models.TOTP
+	if err := doc.DataTo(&totp); err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (f *Firebase) SaveTOTP(ctx context.Context, userID string, totp models.TOTP) error {
+	_, err := f.totpRef(userID).Set(ctx, totp)
+	return err
+}
+
+func (f *Firebase) DeleteTOTP(ctx context.Context, userID string) error {
+	_, err := f.totpRef(userID).Delete(ctx)
+	return err
+}
+
+// UpdateTOTP applies update to a user's enrollment in a transaction, so
+// concurrent attempts cannot use the same code or recovery code twice. The
+// enrollment is saved unless update returns an error.
+func (f *Firebase) UpdateTOTP(ctx context.Context, userID string, update func(totp *models.TOTP) error) error {
+	ref := f.totpRef(userID)
+
+	return f.Firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrTOTPNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var totp models.TOTP
+		if err := doc.DataTo(&totp); err != nil {
+			return err
+		}
+
+		if err := update(&totp); err != nil {
+			return err
+		}
+		return tx.Set(ref, totp)
+	})
+}
+
+// Personal access token operations
+var ErrAccessTokenNotFound = errors.New("personal access token not found")
+
+func (f *Firebase) CreateAccessToken(ctx context.Context, token models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	ref, _, err := f.Firestore.Collection("accessTokens").Add(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = ref.ID
+	return &token, nil
+}
+
+// FindAccessToken returns the token stored under tokenHash.
+func (f *Firebase) FindAccessToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	docs, err := f.Firestore.Collection("accessTokens").Where("tokenHash", "==", tokenHash).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrAccessTokenNotFound
+	}
+
+	var token models.PersonalAccessToken
+	if err := docs[0].DataTo(&token); err != nil {
+		return nil, err
+	}
+	token.ID = docs[0].Ref.ID
+	return &token, nil
+}
+
+// ListAccessTokens returns the tokens of a user, newest first.
+func (f *Firebase) ListAccessTokens(ctx context.Context, userID string) ([]models.PersonalAccessToken, error) {
+	docs, err := f.Firestore.Collection("accessTokens").Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []models.PersonalAccessToken{}
+	for _, doc := range docs {
+		var token models.PersonalAccessToken
+		if err := doc.DataTo(&token); err != nil {
+			return nil, err
+		}
+		token.ID = doc.Ref.ID
+		tokens = append(tokens, token)
 	}
-	_, err := f.Firestore.Collection("refreshTokens").Doc(userID).Set(ctx, data)
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+// DeleteAccessToken revokes a token if it belongs to userID.
+func (f *Firebase) DeleteAccessToken(ctx context.Context, userID, tokenID string) error {
+	ref := f.Firestore.Collection("accessTokens").Doc(tokenID)
+
+	doc, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return ErrAccessTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner, _ := doc.Data()["userId"].(string); owner != userID {
+		return ErrAccessTokenNotFound
+	}
+
+	_, err = ref.Delete(ctx)
+	return err
+}
+
+func (f *Firebase) TouchAccessToken(ctx context.Context, tokenID string, usedAt time.Time) error {
+	_, err := f.Firestore.Collection("accessTokens").Doc(tokenID).Update(ctx, []firestore.Update{
+		{Path: "lastUsedAt", Value: usedAt},
+	})
+	return err
+}
+
+// Session operations
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrRefreshTokenInvalid = errors.New("refresh token is not valid")
+	ErrRefreshTokenReused  = errors.New("refresh token was already rotated")
+)
+
+// RefreshGracePeriod is how long the refresh token replaced by the last
+// rotation may still be presented, e.g. by a second tab or a retry after a
+// lost response, without counting as reuse.
+const RefreshGracePeriod = 30 * time.Second
+
+func (f *Firebase) CreateSession(ctx context.Context, session models.Session) error {
+	_, err := f.Firestore.Collection("sessions").Doc(session.ID).Set(ctx, session)
 	return err
 }
 
-func (f *Firebase) GetRefreshToken(ctx context.Context, userID string) (string, error) {
-	doc, err := f.Firestore.Collection("refreshTokens").Doc(userID).Get(ctx)
+// RotateSession replaces the current refresh token of a session with the one
+// in next and returns the session as stored. The token replaced by the last
+// rotation is accepted within RefreshGracePeriod and gets the session with
+// its current token, which the caller issues again. Any older token of the
+// session has been used before, so the session is revoked.
+func (f *Firebase) RotateSession(ctx context.Context, tokenID string, next models.Session) (*models.Session, error) {
+	ref := f.Firestore.Collection("sessions").Doc(next.ID)
+
+	var reused bool
+	var rotated models.Session
+	err := f.Firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		reused = false
+
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		var current models.Session
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+
+		if current.UserID != next.UserID {
+			return ErrRefreshTokenInvalid
+		}
+
+		if current.TokenID != tokenID {
+			if current.PreviousTokenID == tokenID && time.Since(current.RotatedAt) < RefreshGracePeriod {
+				rotated = current
+				return nil
+			}
+			reused = true
+			return tx.Delete(ref)
+		}
+
+		next.CreatedAt = current.CreatedAt
+		next.PreviousTokenID = tokenID
+		next.RotatedAt = time.Now()
+		rotated = next
+		return tx.Set(ref, next)
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	data := doc.Data()
-	if token, ok := data["token"].(string); ok {
-		return token, nil
+	if reused {
+		return nil, ErrRefreshTokenReused
 	}
-	return "", fmt.Errorf("token not found")
+	rotated.ID = next.ID
+	return &rotated, nil
 }
 
-func (f *Firebase) DeleteRefreshToken(ctx context.Context, userID string) error {
-	_, err := f.Firestore.Collection("refreshTokens").Doc(userID).Delete(ctx)
+// ListSessions returns the unexpired sessions of a user, most recently used
+// first.
+func (f *Firebase) ListSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	docs, err := f.Firestore.Collection("sessions").Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for _, doc := range docs {
+		var session models.Session
+		if err := doc.DataTo(&session); err != nil {
+			return nil, err
+		}
+		if session.ExpiresAt.Before(now) {
+			continue
+		}
+		session.ID = doc.Ref.ID
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// DeleteSession ends a session if it belongs to userID.
+func (f *Firebase) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	ref := f.Firestore.Collection("sessions").Doc(sessionID)
+
+	doc, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner, _ := doc.Data()["userId"].(string); owner != userID {
+		return ErrSessionNotFound
+	}
+
+	_, err = ref.Delete(ctx)
 	return err
 }
 
+// DeleteUserSessions ends every session of a user.
+func (f *Firebase) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	docs, err := f.Firestore.Collection("sessions").Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return i, err
+		}
+	}
+
+	return len(docs), nil
+}
+
+// Revocation operations
+func (f *Firebase) SaveRevocation(ctx context.Context, revocation models.Revocation) error {
+	id := revocation.Kind + ":" + revocation.Subject
+	_, err := f.Firestore.Collection("revocations").Doc(id).Set(ctx, revocation)
+	return err
+}
+
+// WatchRevocations streams revocations that are still in effect after since.
+// The first snapshot contains all of them, later snapshots only the changes.
+func (f *Firebase) WatchRevocations(ctx context.Context, since time.Time) *firestore.QuerySnapshotIterator {
+	return f.Firestore.Collection("revocations").Where("expiresAt", ">", since).Snapshots(ctx)
+}
+
+// DeleteExpiredRevocations removes revocations whose tokens have all expired.
+func (f *Firebase) DeleteExpiredRevocations(ctx context.Context) (int, error) {
+	docs, err := f.Firestore.Collection("revocations").Where("expiresAt", "<=", time.Now()).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return i, err
+		}
+	}
+
+	return len(docs), nil
+}
+
 // Storage operations
-func (f *Firebase) UploadImage(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
+type UploadedObject struct {
+	Path string
+	URL  string
+}
+
+// UploadImage stores an image under a unique name. Private images are not
+// readable by anyone and get an empty URL.
+func (f *Firebase) UploadImage(ctx context.Context, data io.Reader, filename, contentType string, public bool) (*UploadedObject, error) {
 	// Generate unique filename
-	ext := filepath.Ext(fileHeader.Filename)
-	filename := fmt.Sprintf("images/%s%s", uuid.New().String(), ext)
+	ext := filepath.Ext(filename)
+	objectPath := fmt.Sprintf("images/%s%s", uuid.New().String(), ext)
 
-	// Create object handle
-	obj := f.Bucket.Object(filename)
-	writer := obj.NewWriter(ctx)
-	writer.ContentType = fileHeader.Header.Get("Content-Type")
+	if err := f.WriteObject(ctx, objectPath, data, contentType); err != nil {
+		return nil, err
+	}
+
+	if !public {
+		return &UploadedObject{Path: objectPath}, nil
+	}
+
+	url, err := f.PublishObject(ctx, objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadedObject{
+		Path: objectPath,
+		URL:  url,
+	}, nil
+}
+
+func (f *Firebase) WriteObject(ctx context.Context, path string, data io.Reader, contentType string) (err error) {
+	ctx, end := f.startStorageOp(ctx, "write", path)
+	defer end(&err)
+
+	writer := f.Bucket.Object(path).NewWriter(ctx)
+	writer.ContentType = contentType
 
 	// Copy file content
-	if _, err := io.Copy(writer, file); err != nil {
+	if _, err := io.Copy(writer, data); err != nil {
 		writer.Close()
-		return "", fmt.Errorf("failed to upload file: %v", err)
+		return fmt.Errorf("failed to upload file: %v", err)
 	}
 
 	if err := writer.Close(); err != nil {
-		return "", fmt.Errorf("failed to close writer: %v", err)
+		return fmt.Errorf("failed to close writer: %v", err)
 	}
+	return nil
+}
+
+// PublishObject makes an object world-readable and returns its public URL
+func (f *Firebase) PublishObject(ctx context.Context, path string) (_ string, err error) {
+	ctx, end := f.startStorageOp(ctx, "publish", path)
+	defer end(&err)
+
+	obj := f.Bucket.Object(path)
 
 	// Make the file public
 	if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
@@ -169,9 +999,163 @@ func (f *Firebase) UploadImage(ctx context.Context, file multipart.File, fileHea
 	return attrs.MediaLink, nil
 }
 
-func (f *Firebase) DeleteImage(ctx context.Context, path string) error {
+// UnpublishObject removes public read access from an object
+func (f *Firebase) UnpublishObject(ctx context.Context, path string) (err error) {
+	ctx, end := f.startStorageOp(ctx, "unpublish", path)
+	defer end(&err)
+
+	err = f.Bucket.Object(path).ACL().Delete(ctx, storage.AllUsers)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		// The object was not public in the first place
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to make file private: %v", err)
+	}
+	return nil
+}
+
+// OpenObject returns a streaming reader for an object. Callers must close it.
+func (f *Firebase) OpenObject(ctx context.Context, path string) (_ *storage.Reader, err error) {
+	ctx, end := f.startStorageOp(ctx, "open", path)
+	defer end(&err)
+
+	return f.Bucket.Object(path).NewReader(ctx)
+}
+
+// ComposeObjects concatenates srcs into dst. Storage composes at most 32
+// sources per call, so longer lists are merged through intermediate objects.
+func (f *Firebase) ComposeObjects(ctx context.Context, dst string, srcs []string, contentType string) error {
+	const maxComposeSources = 32
+
+	var intermediates []string
+	defer func() {
+		for _, path := range intermediates {
+			f.DeleteObject(ctx, path)
+		}
+	}()
+
+	for round := 0; len(srcs) > maxComposeSources; round++ {
+		var next []string
+		for i := 0; i < len(srcs); i += maxComposeSources {
+			end := min(i+maxComposeSources, len(srcs))
+			part := fmt.Sprintf("%s.compose-%d-%d", dst, round, i/maxComposeSources)
+			if err := f.compose(ctx, part, srcs[i:end], contentType); err != nil {
+				return err
+			}
+			intermediates = append(intermediates, part)
+			next = append(next, part)
+		}
+		srcs = next
+	}
+
+	return f.compose(ctx, dst, srcs, contentType)
+}
+
+func (f *Firebase) compose(ctx context.Context, dst string, srcs []string, contentType string) (err error) {
+	ctx, end := f.startStorageOp(ctx, "compose", dst)
+	defer end(&err)
+
+	handles := make([]*storage.ObjectHandle, 0, len(srcs))
+	for _, src := range srcs {
+		handles = append(handles, f.Bucket.Object(src))
+	}
+
+	composer := f.Bucket.Object(dst).ComposerFrom(handles...)
+	composer.ContentType = contentType
+	if _, err := composer.Run(ctx); err != nil {
+		return fmt.Errorf("failed to compose objects: %v", err)
+	}
+	return nil
+}
+
+func (f *Firebase) DeleteObject(ctx context.Context, path string) (err error) {
+	ctx, end := f.startStorageOp(ctx, "delete", path)
+	defer end(&err)
+
 	obj := f.Bucket.Object(path)
-	return obj.Delete(ctx)
+	err = obj.Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ErrObjectTooLarge is returned by ReadObject for objects above its limit
+var ErrObjectTooLarge = errors.New("object exceeds the size limit")
+
+// ReadObject returns the content and content type of a stored object of at
+// most limit bytes
+func (f *Firebase) ReadObject(ctx context.Context, path string, limit int64) (_ []byte, _ string, err error) {
+	ctx, end := f.startStorageOp(ctx, "read", path)
+	defer end(&err)
+
+	reader, err := f.Bucket.Object(path).NewReader(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	if reader.Attrs.Size > limit {
+		return nil, "", ErrObjectTooLarge
+	}
+	// The stored size is checked above, the reader is capped in case it lies
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > limit {
+		return nil, "", ErrObjectTooLarge
+	}
+	return data, reader.Attrs.ContentType, nil
+}
+
+// ListImages returns the attributes of every object stored under images/
+func (f *Firebase) ListImages(ctx context.Context) (_ []*storage.ObjectAttrs, err error) {
+	ctx, end := f.startStorageOp(ctx, "list", "")
+	defer end(&err)
+
+	var objects []*storage.ObjectAttrs
+	it := f.Bucket.Objects(ctx, &storage.Query{Prefix: "images/"})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, attrs)
+	}
+	return objects, nil
+}
+
+func (f *Firebase) UpdateImageMetadata(ctx context.Context, path string, metadata map[string]string) (err error) {
+	ctx, end := f.startStorageOp(ctx, "update", path)
+	defer end(&err)
+
+	_, err = f.Bucket.Object(path).Update(ctx, storage.ObjectAttrsToUpdate{Metadata: metadata})
+	return err
+}
+
+// startStorageOp starts a span for a Storage operation on object, which may
+// be empty. The returned function ends the span and records the operation's
+// latency; it is deferred with a pointer to the operation's named error.
+func (f *Firebase) startStorageOp(ctx context.Context, operation, object string) (context.Context, func(*error)) {
+	start := time.Now()
+	attrs := []attribute.KeyValue{attribute.String("gcs.bucket", f.BucketName)}
+	if object != "" {
+		attrs = append(attrs, attribute.String("gcs.object", object))
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, func(err *error) {
+		tracing.End(span, *err)
+		metrics.ObserveStorage(operation, start, *err)
+	}
 }
 
 // Helper to parse service account JSON
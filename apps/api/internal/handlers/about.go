@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"blog/api/internal/audit"
 	"blog/api/internal/database"
 	"blog/api/internal/models"
 	"context"
@@ -15,15 +16,17 @@ import (
 )
 
 type AboutHandler struct {
-	db *database.MongoDB
+	db    *database.MongoDB
+	audit *audit.Log
 }
 
-func NewAboutHandler(db *database.MongoDB) *AboutHandler {
-	return &AboutHandler{db: db}
+func NewAboutHandler(db *database.MongoDB, auditLog *audit.Log) *AboutHandler {
+	return &AboutHandler{db: db, audit: auditLog}
 }
 
 func (h *AboutHandler) GetAbout(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 
 	var about models.About
 	err := h.db.Abouts().FindOne(ctx, bson.M{"slug": "main"}).Decode(&about)
@@ -32,7 +35,7 @@ func (h *AboutHandler) GetAbout(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "About page not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch about page"})
+		respondInternalError(c, "Failed to fetch about page", err)
 		return
 	}
 
@@ -40,7 +43,8 @@ func (h *AboutHandler) GetAbout(c *gin.Context) {
 }
 
 func (h *AboutHandler) UpdateAbout(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 
 	var req models.UpdateAboutRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -48,6 +52,13 @@ func (h *AboutHandler) UpdateAbout(c *gin.Context) {
 		return
 	}
 
+	// Kept for the audit log; a missing page diffs against nothing
+	var previous interface{}
+	var existing models.About
+	if err := h.db.Abouts().FindOne(ctx, bson.M{"slug": "main"}).Decode(&existing); err == nil {
+		previous = existing
+	}
+
 	now := time.Now()
 	update := bson.M{
 		"slug":      "main",
@@ -78,14 +89,21 @@ func (h *AboutHandler) UpdateAbout(c *gin.Context) {
 			}
 			_, err = h.db.Abouts().InsertOne(ctx, about)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create about page"})
+				respondInternalError(c, "Failed to create about page", err)
 				return
 			}
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update about page"})
+			respondInternalError(c, "Failed to update about page", err)
 			return
 		}
 	}
 
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditAboutUpdate,
+		TargetType: models.AuditTargetAbout,
+		TargetID:   about.ID.Hex(),
+		Changes:    audit.Diff(previous, about, "id", "updatedAt"),
+	})
+
 	c.JSON(http.StatusOK, about)
 }
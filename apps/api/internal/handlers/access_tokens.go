@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"blog/api/internal/audit"
+	"blog/api/internal/firebase"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"blog/api/pkg/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessTokenHintLength is how much of a token is kept in clear for listings,
+// including the prefix.
+const accessTokenHintLength = len(models.PersonalAccessTokenPrefix) + 4
+
+type AccessTokensHandler struct {
+	firebase *firebase.Firebase
+	audit    *audit.Log
+}
+
+func NewAccessTokensHandler(fb *firebase.Firebase, auditLog *audit.Log) *AccessTokensHandler {
+	return &AccessTokensHandler{
+		firebase: fb,
+		audit:    auditLog,
+	}
+}
+
+func (h *AccessTokensHandler) ListAccessTokens(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	tokens, err := h.firebase.ListAccessTokens(ctx, userID)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch access tokens", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateAccessToken issues a personal access token. The token is returned in
+// this response only; the API keeps its hash.
+func (h *AccessTokensHandler) CreateAccessToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	secret, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		respondInternalError(c, "Failed to generate access token", err)
+		return
+	}
+	tokenString := models.PersonalAccessTokenPrefix + secret
+
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		TokenHash: utils.HashOpaqueToken(tokenString),
+		Hint:      tokenString[:accessTokenHintLength],
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := token.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	created, err := h.firebase.CreateAccessToken(ctx, token)
+	if err != nil {
+		respondInternalError(c, "Failed to save access token", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditAccessTokenCreate,
+		TargetType: models.AuditTargetAccessToken,
+		TargetID:   created.ID,
+		Details:    map[string]string{"name": created.Name, "scopes": strings.Join(created.Scopes, ",")},
+	})
+
+	c.JSON(http.StatusCreated, models.CreatePersonalAccessTokenResponse{
+		Token:               tokenString,
+		PersonalAccessToken: *created,
+	})
+}
+
+func (h *AccessTokensHandler) DeleteAccessToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	tokenID := c.Param("id")
+	err := h.firebase.DeleteAccessToken(ctx, userID, tokenID)
+	if errors.Is(err, firebase.ErrAccessTokenNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to delete access token", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditAccessTokenDelete,
+		TargetType: models.AuditTargetAccessToken,
+		TargetID:   tokenID,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "Access token revoked successfully",
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"blog/api/internal/audit"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	audit *audit.Log
+}
+
+func NewAuditHandler(auditLog *audit.Log) *AuditHandler {
+	return &AuditHandler{audit: auditLog}
+}
+
+// ListEntries returns a page of the audit log, newest first.
+func (h *AuditHandler) ListEntries(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	entries, total, err := h.audit.Find(ctx, filter, page, limit)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch audit log", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AuditLogResponse{
+		Entries: entries,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	})
+}
+
+// ExportEntries streams every matching entry as JSON Lines, oldest first.
+func (h *AuditHandler) ExportEntries(c *gin.Context) {
+	// Exports run for as long as the client keeps reading
+	ctx := c.Request.Context()
+	extendWriteDeadline(c)
+	extendReadDeadline(c)
+
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + ".jsonl"
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the export short
+	if err := h.audit.Export(ctx, filter, c.Writer); err != nil {
+		middleware.GetLogger(c).Error("Failed to export audit log", "error", err)
+	}
+}
+
+// parseAuditFilter reads the actor, action, targetType, targetId, from and to
+// query parameters. from and to are RFC 3339 timestamps.
+func parseAuditFilter(c *gin.Context) (audit.Filter, bool) {
+	filter := audit.Filter{
+		ActorID:    c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+	}
+
+	for param, dest := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " timestamp, expected RFC 3339"})
+			return filter, false
+		}
+		*dest = t
+	}
+
+	return filter, true
+}
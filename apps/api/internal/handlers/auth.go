@@ -1,31 +1,47 @@
 package handlers
 
 import (
+	"blog/api/internal/audit"
 	"blog/api/internal/config"
 	"blog/api/internal/firebase"
+	"blog/api/internal/logging"
+	"blog/api/internal/login"
+	"blog/api/internal/metrics"
 	"blog/api/internal/middleware"
 	"blog/api/internal/models"
+	"blog/api/internal/revocation"
 	"blog/api/pkg/utils"
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/idtoken"
+	"github.com/google/uuid"
 )
 
 type AuthHandler struct {
-	cfg      *config.Config
-	firebase *firebase.Firebase
+	cfg         *config.Config
+	firebase    *firebase.Firebase
+	revocations *revocation.List
+	providers   *login.Registry
+	audit       *audit.Log
 }
 
-func NewAuthHandler(cfg *config.Config, fb *firebase.Firebase) *AuthHandler {
+func NewAuthHandler(cfg *config.Config, fb *firebase.Firebase, revocations *revocation.List, providers *login.Registry, auditLog *audit.Log) *AuthHandler {
 	return &AuthHandler{
-		cfg:      cfg,
-		firebase: fb,
+		cfg:         cfg,
+		firebase:    fb,
+		revocations: revocations,
+		providers:   providers,
+		audit:       auditLog,
 	}
 }
 
+// GoogleLogin is kept for existing clients; it is the same as logging in
+// with the google provider.
 func (h *AuthHandler) GoogleLogin(c *gin.Context) {
 	var req models.GoogleLoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -33,74 +49,227 @@ func (h *AuthHandler) GoogleLogin(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	h.loginWith(c, "google", login.Credential{Token: req.Token}, req.InviteToken)
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Token == "" && req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token or code is required"})
+		return
+	}
 
-	// Validate Google token
-	payload, err := idtoken.Validate(ctx, req.Token, h.cfg.GoogleClientID)
+	h.loginWith(c, c.Param("provider"), login.Credential{
+		Token:        req.Token,
+		Code:         req.Code,
+		RedirectURI:  req.RedirectURI,
+		CodeVerifier: req.CodeVerifier,
+	}, req.InviteToken)
+}
+
+func (h *AuthHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, h.providers.Infos())
+}
+
+func (h *AuthHandler) loginWith(c *gin.Context, providerName string, credential login.Credential, inviteToken string) {
+	provider, err := h.providers.Get(providerName)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google token"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
 		return
 	}
 
-	email := payload.Claims["email"].(string)
-	name, _ := payload.Claims["name"].(string)
-	picture, _ := payload.Claims["picture"].(string)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 
-	// Check if user is admin
-	if !h.cfg.IsAdminEmail(email) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admin users can log in"})
+	identity, err := provider.Authenticate(ctx, credential)
+	if err != nil {
+		middleware.GetLogger(c).Warn("Login failed", "provider", providerName, "error", err)
+		metrics.AuthFailed(providerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid login credential"})
 		return
 	}
 
-	userID := payload.Subject
+	h.completeLogin(c, ctx, identity, inviteToken, providerName)
+}
+
+// completeLogin signs in the user behind a verified identity, creating the
+// account from an allowlist entry or invitation on first login.
+func (h *AuthHandler) completeLogin(c *gin.Context, ctx context.Context, identity *login.Identity, inviteToken, method string) {
+	userID := identity.UserID
+	// Users are looked up by lowercased email
+	email := strings.ToLower(identity.Email)
 
 	// Create or update user in Firestore
 	userData := map[string]interface{}{
 		"email":       email,
-		"name":        name,
-		"picture":     picture,
+		"name":        identity.Name,
+		"picture":     identity.Picture,
+		"status":      models.UserActive,
 		"lastLoginAt": time.Now(),
 	}
 
-	// Check if user exists
+	// Only existing users, allowlisted emails and invite token holders may
+	// log in
+	var role, invitationID string
 	existingUser, err := h.firebase.GetUser(ctx, userID)
 	if err != nil || existingUser == nil {
+		// Allowlist entries and invitations are matched by email, so the
+		// provider must have verified it
+		if !identity.EmailVerified {
+			metrics.AuthFailed(method)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your email address is not verified"})
+			return
+		}
+
+		if inviteToken != "" {
+			invitation, err := h.firebase.AcceptInvitation(ctx, utils.HashOpaqueToken(inviteToken), email, userID)
+			if err != nil {
+				respondInvitationError(c, err)
+				return
+			}
+			role = invitation.Role
+
+			// Drop a matching allowlist entry so it does not linger
+			if invited, err := h.firebase.FindUserByEmail(ctx, email); err == nil && invited.Status == models.UserInvited {
+				invitationID = invited.ID
+			}
+		} else {
+			invited, err := h.firebase.FindUserByEmail(ctx, email)
+			if err != nil || invited.Status != models.UserInvited {
+				metrics.AuthFailed(method)
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only admin users can log in"})
+				return
+			}
+			role = invited.Role
+			invitationID = invited.ID
+		}
+
 		// New user
 		userData["createdAt"] = time.Now()
+	} else {
+		if status, _ := existingUser["status"].(string); status == models.UserDisabled {
+			metrics.AuthFailed(method)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been disabled"})
+			return
+		}
+		role, _ = existingUser["role"].(string)
+	}
+
+	// Users without a role get one on first login
+	if role == "" {
+		role, err = h.initialRole(ctx, userID)
+		if err != nil {
+			respondInternalError(c, "Failed to assign role", err)
+			return
+		}
 	}
+	userData["role"] = role
 
 	err = h.firebase.CreateOrUpdateUser(ctx, userID, userData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create/update user"})
+		respondInternalError(c, "Failed to create/update user", err)
 		return
 	}
 
+	// The invitation is replaced by the account
+	if invitationID != "" {
+		if err := h.firebase.DeleteUser(ctx, invitationID); err != nil {
+			middleware.GetLogger(c).Error("Failed to remove invitation", "invitationId", invitationID, "error", err)
+		}
+	}
+
+	// Users with a second factor get a challenge instead of tokens
+	totp, err := h.firebase.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, firebase.ErrTOTPNotFound) {
+		respondInternalError(c, "Failed to check MFA", err)
+		return
+	}
+	if totp != nil && totp.Enabled {
+		mfaToken, err := utils.GenerateMFAToken(userID, email, h.cfg.JWTKeys)
+		if err != nil {
+			respondInternalError(c, "Failed to generate MFA token", err)
+			return
+		}
+		c.JSON(http.StatusOK, models.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			Methods:     []string{models.MFAMethodTOTP, models.MFAMethodRecoveryCode},
+		})
+		return
+	}
+
+	h.issueTokens(c, ctx, models.User{
+		ID:      userID,
+		Email:   email,
+		Name:    identity.Name,
+		Picture: identity.Picture,
+		Role:    role,
+	}, method)
+}
+
+// issueTokens starts a new session for the user and responds with its token
+// pair. method names how the user logged in, for the audit log.
+func (h *AuthHandler) issueTokens(c *gin.Context, ctx context.Context, user models.User, method string) {
+	// Each login starts a new session for this device
+	now := time.Now()
+	session := models.Session{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		TokenID:    uuid.NewString(),
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(utils.RefreshTokenTTL),
+	}
+
 	// Generate JWT tokens
-	accessToken, err := utils.GenerateAccessToken(userID, email, h.cfg.JWTSecret)
+	accessToken, err := utils.GenerateAccessToken(user.ID, user.Email, user.Role, session.ID, h.cfg.JWTKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		respondInternalError(c, "Failed to generate access token", err)
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(userID, email, h.cfg.JWTSecret)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, session.ID, session.TokenID, h.cfg.JWTKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		respondInternalError(c, "Failed to generate refresh token", err)
 		return
 	}
 
-	// Save refresh token to Firestore
-	err = h.firebase.SaveRefreshToken(ctx, userID, refreshToken)
+	// Save session to Firestore
+	err = h.firebase.CreateSession(ctx, session)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save refresh token"})
+		respondInternalError(c, "Failed to save session", err)
 		return
 	}
 
-	// Get user data for response
-	user := models.User{
-		ID:      userID,
-		Email:   email,
-		Name:    name,
-		Picture: picture,
+	metrics.AuthSucceeded(method)
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditLogin,
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		TargetType: models.AuditTargetSession,
+		TargetID:   session.ID,
+		Details:    map[string]string{"method": method},
+	})
+
+	// In cookie mode the tokens never reach scripts
+	if h.cfg.AuthCookies {
+		csrfToken, err := middleware.SetAuthCookies(c, h.cfg, accessToken, refreshToken)
+		if err != nil {
+			respondInternalError(c, "Failed to generate CSRF token", err)
+			return
+		}
+		c.JSON(http.StatusOK, models.AuthResponse{
+			CSRFToken: csrfToken,
+			User:      user,
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, models.AuthResponse{
@@ -112,39 +281,128 @@ func (h *AuthHandler) GoogleLogin(c *gin.Context) {
 
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req models.RefreshTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate refresh token
-	claims, err := utils.ValidateToken(req.RefreshToken, h.cfg.JWTSecret)
+	if req.RefreshToken == "" && h.cfg.AuthCookies {
+		req.RefreshToken, _ = c.Cookie(middleware.RefreshTokenCookie)
+		if req.RefreshToken != "" && !middleware.ValidCSRF(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refreshToken is required"})
+		return
+	}
+
+	// Validate refresh token; anything else must not reach RotateSession,
+	// where an unknown jti counts as reuse and revokes the session
+	claims, err := utils.ValidateRefreshToken(req.RefreshToken, h.cfg.JWTKeys)
+	if err != nil || claims.ID == "" || claims.SessionID == "" {
+		metrics.AuthFailed("refresh")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	// Access tokens carry the current role, which may have changed since login
+	userData, err := h.firebase.GetUser(ctx, claims.UserID)
 	if err != nil {
+		metrics.AuthFailed("refresh")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
+	role, _ := userData["role"].(string)
 
-	ctx := context.Background()
+	// Disabled users lose all their sessions
+	if status, _ := userData["status"].(string); status == models.UserDisabled {
+		h.endUserSessions(ctx, claims.UserID)
+		metrics.AuthFailed("refresh")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been disabled"})
+		return
+	}
 
-	// Check if refresh token exists in Firestore
-	storedToken, err := h.firebase.GetRefreshToken(ctx, claims.UserID)
-	if err != nil || storedToken != req.RefreshToken {
+	// Rotate the refresh token, invalidating the presented one
+	now := time.Now()
+	next := models.Session{
+		ID:         claims.SessionID,
+		UserID:     claims.UserID,
+		TokenID:    uuid.NewString(),
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(utils.RefreshTokenTTL),
+	}
+
+	session, err := h.firebase.RotateSession(ctx, claims.ID, next)
+	switch {
+	case errors.Is(err, firebase.ErrRefreshTokenReused):
+		middleware.GetLogger(c).Warn("Refresh token reuse detected, revoked session", "userId", claims.UserID, "sessionId", claims.SessionID)
+		h.revokeSession(ctx, claims.SessionID)
+		metrics.AuthFailed("refresh")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case errors.Is(err, firebase.ErrRefreshTokenInvalid):
+		metrics.AuthFailed("refresh")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
+	case err != nil:
+		respondInternalError(c, "Failed to rotate refresh token", err)
+		return
+	}
+
+	// A refresh racing an earlier one with the same token gets the token
+	// that one was issued
+	refreshToken, err := utils.GenerateRefreshToken(claims.UserID, claims.Email, session.ID, session.TokenID, h.cfg.JWTKeys)
+	if err != nil {
+		respondInternalError(c, "Failed to generate refresh token", err)
+		return
 	}
 
 	// Generate new access token
-	accessToken, err := utils.GenerateAccessToken(claims.UserID, claims.Email, h.cfg.JWTSecret)
+	accessToken, err := utils.GenerateAccessToken(claims.UserID, claims.Email, role, claims.SessionID, h.cfg.JWTKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		respondInternalError(c, "Failed to generate access token", err)
+		return
+	}
+
+	metrics.AuthSucceeded("refresh")
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditTokenRefresh,
+		ActorID:    claims.UserID,
+		ActorEmail: claims.Email,
+		TargetType: models.AuditTargetSession,
+		TargetID:   claims.SessionID,
+	})
+
+	if h.cfg.AuthCookies {
+		csrfToken, err := middleware.SetAuthCookies(c, h.cfg, accessToken, refreshToken)
+		if err != nil {
+			respondInternalError(c, "Failed to generate CSRF token", err)
+			return
+		}
+		c.JSON(http.StatusOK, models.TokenResponse{CSRFToken: csrfToken})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.TokenResponse{
-		AccessToken: accessToken,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 	})
 }
 
+// JWKS publishes the public keys tokens are verified with so other services
+// can validate them without sharing a secret.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.cfg.JWTKeys.JWKS())
+}
+
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -152,7 +410,8 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 
 	// Get user from Firestore
 	userData, err := h.firebase.GetUser(ctx, userID)
@@ -167,10 +426,13 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		Name:    userData["name"].(string),
 		Picture: userData["picture"].(string),
 	}
+	user.Role, _ = userData["role"].(string)
 
 	c.JSON(http.StatusOK, user)
 }
 
+// Logout ends the session the access token was issued for. Other devices stay
+// signed in.
 func (h *AuthHandler) Logout(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -178,16 +440,161 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	sessionID, ok := middleware.GetSessionID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found"})
+		return
+	}
 
-	// Delete refresh token from Firestore
-	err := h.firebase.DeleteRefreshToken(ctx, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	// Delete session from Firestore
+	err := h.firebase.DeleteSession(ctx, userID, sessionID)
+	if err != nil && !errors.Is(err, firebase.ErrSessionNotFound) {
+		respondInternalError(c, "Failed to logout", err)
 		return
 	}
+	h.revokeSession(ctx, sessionID)
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditLogout,
+		TargetType: models.AuditTargetSession,
+		TargetID:   sessionID,
+	})
+
+	if h.cfg.AuthCookies {
+		middleware.ClearAuthCookies(c, h.cfg)
+	}
 
 	c.JSON(http.StatusOK, models.MessageResponse{
 		Message: "Logged out successfully",
 	})
 }
+
+// LogoutAll ends every session of the user, including the current one.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	if err := h.endUserSessions(ctx, userID); err != nil {
+		respondInternalError(c, "Failed to logout", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditLogoutAll,
+		TargetType: models.AuditTargetSession,
+	})
+
+	if h.cfg.AuthCookies {
+		middleware.ClearAuthCookies(c, h.cfg)
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "Logged out of all sessions",
+	})
+}
+
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	sessions, err := h.firebase.ListSessions(ctx, userID)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch sessions", err)
+		return
+	}
+
+	currentID, _ := middleware.GetSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *AuthHandler) DeleteSession(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	sessionID := c.Param("id")
+	err := h.firebase.DeleteSession(ctx, userID, sessionID)
+	if errors.Is(err, firebase.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to delete session", err)
+		return
+	}
+	h.revokeSession(ctx, sessionID)
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "Session deleted successfully",
+	})
+}
+
+// revokeSession makes the access tokens of an ended session unusable right
+// away instead of when they expire.
+func (h *AuthHandler) revokeSession(ctx context.Context, sessionID string) {
+	if err := h.revocations.RevokeSession(ctx, sessionID); err != nil {
+		logging.FromContext(ctx).Error("Failed to persist revocation of session", "sessionId", sessionID, "error", err)
+	}
+}
+
+// endUserSessions deletes every session of a user and revokes the access
+// tokens issued so far.
+func (h *AuthHandler) endUserSessions(ctx context.Context, userID string) error {
+	if err := h.revocations.RevokeUser(ctx, userID); err != nil {
+		logging.FromContext(ctx).Error("Failed to persist revocation of user", "targetUserId", userID, "error", err)
+	}
+	_, err := h.firebase.DeleteUserSessions(ctx, userID)
+	return err
+}
+
+// initialRole makes the first user the owner so someone can assign roles;
+// everyone after that starts as a contributor.
+func (h *AuthHandler) initialRole(ctx context.Context, userID string) (string, error) {
+	claimed, err := h.firebase.ClaimFirstOwner(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if claimed {
+		return models.RoleOwner, nil
+	}
+	return models.RoleContributor, nil
+}
+
+func respondInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, firebase.ErrInvitationNotFound):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid invitation"})
+	case errors.Is(err, firebase.ErrInvitationExpired):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invitation has expired"})
+	case errors.Is(err, firebase.ErrInvitationUsed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invitation has already been used"})
+	case errors.Is(err, firebase.ErrInvitationEmail):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invitation was sent to a different email"})
+	default:
+		respondInternalError(c, "Failed to accept invitation", err)
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"blog/api/internal/middleware"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondInternalError logs err with the request's logger and responds with
+// message only, so internal details never reach the client.
+// A nil err is allowed for failures detected without one, such as a write
+// that matched nothing.
+func respondInternalError(c *gin.Context, message string, err error) {
+	logger := middleware.GetLogger(c)
+	if err != nil {
+		logger = logger.With("error", err)
+	}
+	logger.Error(message)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"blog/api/internal/audit"
+	"blog/api/internal/config"
+	"blog/api/internal/firebase"
+	"blog/api/internal/mailer"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"blog/api/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvitationsHandler struct {
+	cfg      *config.Config
+	firebase *firebase.Firebase
+	mailer   mailer.Mailer
+	audit    *audit.Log
+}
+
+func NewInvitationsHandler(cfg *config.Config, fb *firebase.Firebase, m mailer.Mailer, auditLog *audit.Log) *InvitationsHandler {
+	return &InvitationsHandler{
+		cfg:      cfg,
+		firebase: fb,
+		mailer:   m,
+		audit:    auditLog,
+	}
+}
+
+// CreateInvitation emails a single-use invite link. The token is only ever
+// sent to the invitee; the API keeps its hash.
+func (h *InvitationsHandler) CreateInvitation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.firebase.FindUserByEmail(ctx, req.Email)
+	if err == nil && existing.Status != models.UserInvited {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+	if err != nil && !errors.Is(err, firebase.ErrUserNotFound) {
+		respondInternalError(c, "Failed to create invitation", err)
+		return
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		respondInternalError(c, "Failed to create invitation", err)
+		return
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		Email:     strings.ToLower(req.Email),
+		Role:      req.Role,
+		InvitedBy: userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.InvitationTTL),
+	}
+
+	tokenHash := utils.HashOpaqueToken(token)
+	if err := h.firebase.CreateInvitation(ctx, tokenHash, invitation); err != nil {
+		respondInternalError(c, "Failed to create invitation", err)
+		return
+	}
+	invitation.ID = tokenHash
+
+	link := h.cfg.FrontendURL + "/admin/login?invite=" + url.QueryEscape(token)
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited to the blog",
+		Body: fmt.Sprintf("You have been invited to join the blog as %s.\n\n"+
+			"Sign in with your Google account %s using this link:\n\n%s\n\n"+
+			"The link can be used once and expires on %s.\n",
+			invitation.Role, invitation.Email, link, invitation.ExpiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		// Without the email the token is lost, so drop the invitation
+		if err := h.firebase.DeleteInvitation(ctx, tokenHash); err != nil {
+			middleware.GetLogger(c).Error("Failed to delete unsent invitation", "error", err)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send invitation email"})
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditInvitationCreate,
+		TargetType: models.AuditTargetInvitation,
+		TargetID:   invitation.ID,
+		Details:    map[string]string{"email": invitation.Email, "role": invitation.Role},
+	})
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+func (h *InvitationsHandler) ListInvitations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	invitations, err := h.firebase.ListInvitations(ctx)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch invitations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+func (h *InvitationsHandler) DeleteInvitation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	invitationID := c.Param("id")
+	err := h.firebase.DeleteInvitation(ctx, invitationID)
+	if errors.Is(err, firebase.ErrInvitationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to delete invitation", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditInvitationDelete,
+		TargetType: models.AuditTargetInvitation,
+		TargetID:   invitationID,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "Invitation deleted successfully",
+	})
+}
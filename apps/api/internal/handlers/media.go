@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"blog/api/internal/audit"
+	"blog/api/internal/database"
+	"blog/api/internal/firebase"
+	"blog/api/internal/media"
+	"blog/api/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MediaHandler struct {
+	db        *database.MongoDB
+	firebase  *firebase.Firebase
+	store     *media.Store
+	collector *media.Collector
+	audit     *audit.Log
+}
+
+func NewMediaHandler(db *database.MongoDB, fb *firebase.Firebase, store *media.Store, collector *media.Collector, auditLog *audit.Log) *MediaHandler {
+	return &MediaHandler{
+		db:        db,
+		firebase:  fb,
+		store:     store,
+		collector: collector,
+		audit:     auditLog,
+	}
+}
+
+// mediaAuditIgnore lists media fields left out of audit change summaries
+var mediaAuditIgnore = []string{"id", "createdAt", "updatedAt"}
+
+func (h *MediaHandler) ListMedia(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	// Parse query parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	query := c.Query("q")
+	mediaType := c.Query("type")
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	skip := (page - 1) * limit
+
+	// Build filter
+	filter := bson.M{}
+	if query != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+		filter["$or"] = bson.A{
+			bson.M{"filename": pattern},
+			bson.M{"altText": pattern},
+			bson.M{"caption": pattern},
+		}
+	}
+	if mediaType != "" {
+		// Match either an exact type ("image/png") or a family ("image")
+		filter["contentType"] = bson.M{"$regex": "^" + regexp.QuoteMeta(mediaType)}
+	}
+
+	total, err := h.db.Media().CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, "Failed to count media", err)
+		return
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	cursor, err := h.db.Media().Find(ctx, filter, opts)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch media", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	media := []models.Media{}
+	if err := cursor.All(ctx, &media); err != nil {
+		respondInternalError(c, "Failed to decode media", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MediaListResponse{
+		Media:   media,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+		HasMore: int64(skip+len(media)) < total,
+	})
+}
+
+func (h *MediaHandler) GetMedia(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	var media models.Media
+	err = h.db.Media().FindOne(ctx, bson.M{"_id": objectID}).Decode(&media)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	references, err := h.findReferences(ctx, media)
+	if err != nil {
+		respondInternalError(c, "Failed to check media references", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MediaDetailResponse{
+		Media:      media,
+		References: references,
+	})
+}
+
+func (h *MediaHandler) UpdateMedia(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	var req models.UpdateMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Build update document
+	update := bson.M{"updatedAt": time.Now()}
+	if req.AltText != nil {
+		update["altText"] = *req.AltText
+	}
+	if req.Caption != nil {
+		update["caption"] = *req.Caption
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var existing models.Media
+	err = h.db.Media().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": update},
+		opts,
+	).Decode(&existing)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	item := existing
+	if req.AltText != nil {
+		item.AltText = *req.AltText
+	}
+	if req.Caption != nil {
+		item.Caption = *req.Caption
+	}
+
+	if req.Visibility != nil && *req.Visibility != item.Visibility {
+		updated, err := h.store.SetVisibility(ctx, &item, *req.Visibility)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		item = *updated
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditMediaUpdate,
+		TargetType: models.AuditTargetMedia,
+		TargetID:   item.ID.Hex(),
+		Changes:    audit.Diff(existing, item, mediaAuditIgnore...),
+	})
+
+	c.JSON(http.StatusOK, item)
+}
+
+// CreateSignedURL mints a time-limited URL for reading private media
+func (h *MediaHandler) CreateSignedURL(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	var req models.SignedURLRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var item models.Media
+	err = h.db.Media().FindOne(ctx, bson.M{"_id": objectID}).Decode(&item)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	url, expiresAt, err := h.store.SignedURL(&item, time.Duration(req.TTL)*time.Second)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SignedURLResponse{
+		URL:       url,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ServeFile streams media through the API. Public media is redirected to its
+// storage link, anything else requires a valid signature.
+func (h *MediaHandler) ServeFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	objectPath := strings.TrimPrefix(c.Param("path"), "/")
+
+	var item models.Media
+	err := h.db.Media().FindOne(ctx, bson.M{"path": objectPath}).Decode(&item)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	if item.Visibility == models.MediaPublic && item.PublicURL != "" {
+		c.Redirect(http.StatusFound, item.PublicURL)
+		return
+	}
+
+	expires := c.Query("expires")
+	if !h.store.VerifySignature(item.Path, expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired signature"})
+		return
+	}
+
+	reader, err := h.firebase.OpenObject(ctx, item.Path)
+	if err != nil {
+		respondInternalError(c, "Failed to read media file", err)
+		return
+	}
+	defer reader.Close()
+
+	// Let clients cache the response no longer than the signature is valid
+	expiresUnix, _ := strconv.ParseInt(expires, 10, 64)
+	maxAge := max(0, expiresUnix-time.Now().Unix())
+
+	// Large files are streamed for as long as the client keeps reading
+	extendWriteDeadline(c)
+	extendReadDeadline(c)
+	c.DataFromReader(http.StatusOK, reader.Attrs.Size, item.ContentType, reader, map[string]string{
+		"Cache-Control": fmt.Sprintf("private, max-age=%d", maxAge),
+	})
+}
+
+func (h *MediaHandler) DeleteMedia(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+	force := c.Query("force") == "true"
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	var media models.Media
+	err = h.db.Media().FindOne(ctx, bson.M{"_id": objectID}).Decode(&media)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	// Other uploads share this object through deduplication, so release
+	// one reference and keep the object, whether or not posts use it
+	if media.RefCount > 1 {
+		var released models.Media
+		err = h.db.Media().FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID, "refCount": bson.M{"$gt": 1}},
+			bson.M{"$inc": bson.M{"refCount": -1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&released)
+		switch {
+		case err == nil:
+			h.audit.Record(c, models.AuditEntry{
+				Action:     models.AuditMediaDelete,
+				TargetType: models.AuditTargetMedia,
+				TargetID:   media.ID.Hex(),
+				Details:    map[string]string{"filename": media.Filename, "refCount": strconv.Itoa(released.RefCount)},
+			})
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "Media reference released",
+				"refCount": released.RefCount,
+			})
+			return
+		case !errors.Is(err, mongo.ErrNoDocuments):
+			respondInternalError(c, "Failed to release media reference", err)
+			return
+		}
+		// The other references were released in the meantime, so this is
+		// the last one
+	}
+
+	// Refuse to delete media that posts still use unless explicitly forced
+	references, err := h.findReferences(ctx, media)
+	if err != nil {
+		respondInternalError(c, "Failed to check media references", err)
+		return
+	}
+	if len(references) > 0 && !force {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Media is still referenced by posts. Retry with force=true to delete anyway",
+			"references": references,
+		})
+		return
+	}
+
+	// Remove the entry only while this is still the last reference, so an
+	// upload deduplicated against it in the meantime keeps its object.
+	// Entries from before reference counting have none recorded.
+	result, err := h.db.Media().DeleteOne(ctx, bson.M{
+		"_id": objectID,
+		"$or": bson.A{
+			bson.M{"refCount": bson.M{"$lte": 1}},
+			bson.M{"refCount": bson.M{"$exists": false}},
+		},
+	})
+	if err != nil {
+		respondInternalError(c, "Failed to delete media", err)
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Media was reused by another upload, please retry"})
+		return
+	}
+
+	// Images left behind are collected by media garbage collection
+	if err := h.firebase.DeleteObject(ctx, media.Path); err != nil {
+		respondInternalError(c, "Failed to delete media file", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditMediaDelete,
+		TargetType: models.AuditTargetMedia,
+		TargetID:   media.ID.Hex(),
+		Changes:    audit.Diff(media, nil, mediaAuditIgnore...),
+		Details:    map[string]string{"forced": strconv.FormatBool(len(references) > 0)},
+	})
+
+	response := gin.H{"message": "Media deleted successfully"}
+	if len(references) > 0 {
+		response["warning"] = "Deleted media was still referenced by posts"
+		response["references"] = references
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetGCReport reports which unreferenced images a collection pass would
+// quarantine or delete without changing anything.
+func (h *MediaHandler) GetGCReport(c *gin.Context) {
+	h.collect(c, true)
+}
+
+// RunGC runs a collection pass immediately. Pass dryRun=true to only report.
+func (h *MediaHandler) RunGC(c *gin.Context) {
+	h.collect(c, c.Query("dryRun") == "true")
+}
+
+func (h *MediaHandler) collect(c *gin.Context, dryRun bool) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), jobTimeout)
+	defer cancel()
+	extendWriteDeadline(c)
+	extendReadDeadline(c)
+
+	report, err := h.collector.Collect(ctx, dryRun)
+	if err != nil {
+		if errors.Is(err, media.ErrCollectionRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Garbage collection is already running"})
+			return
+		}
+		respondInternalError(c, "Failed to collect unreferenced media", err)
+		return
+	}
+
+	if !dryRun {
+		h.audit.Record(c, models.AuditEntry{
+			Action:     models.AuditMediaGC,
+			TargetType: models.AuditTargetMedia,
+			Details: map[string]string{
+				"quarantined": strconv.Itoa(len(report.Quarantined)),
+				"restored":    strconv.Itoa(len(report.Restored)),
+				"deleted":     strconv.Itoa(len(report.Deleted)),
+				"freedBytes":  strconv.FormatInt(report.FreedBytes, 10),
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// BackfillPlaceholders computes placeholders for existing post cover images
+func (h *MediaHandler) BackfillPlaceholders(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), jobTimeout)
+	defer cancel()
+	extendWriteDeadline(c)
+	extendReadDeadline(c)
+
+	report, err := media.BackfillPlaceholders(ctx, h.db, h.firebase)
+	if err != nil {
+		respondInternalError(c, "Failed to backfill placeholders", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// findReferences returns the posts whose content or cover image point at the
+// media object. Object names are UUID based, so matching on the base name
+// covers both raw and URL-encoded storage links.
+func (h *MediaHandler) findReferences(ctx context.Context, item models.Media) ([]models.MediaReference, error) {
+	pattern := bson.M{"$regex": regexp.QuoteMeta(media.ObjectKey(item.Path))}
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"content": pattern},
+			bson.M{"imageUrl": pattern},
+		},
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "title": 1})
+
+	cursor, err := h.db.Posts().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+
+	references := []models.MediaReference{}
+	for _, post := range posts {
+		references = append(references, models.MediaReference{
+			PostID: post.ID,
+			Title:  post.Title,
+		})
+	}
+
+	return references, nil
+}
@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"blog/api/internal/config"
+	"blog/api/internal/firebase"
+	"blog/api/internal/metrics"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"blog/api/internal/revocation"
+	"blog/api/pkg/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	recoveryCodeCount = 10
+	// After maxMFAFailures wrong codes in a row, codes are refused for
+	// mfaLockout
+	maxMFAFailures = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+type secondFactorResult int
+
+const (
+	secondFactorValid secondFactorResult = iota
+	secondFactorInvalid
+	secondFactorLocked
+)
+
+// errTOTPAlreadyEnabled aborts a confirmation of an enrollment that is
+// already active.
+var errTOTPAlreadyEnabled = errors.New("totp is already enabled")
+
+// MFAHandler manages TOTP enrollment and completes logins that require a
+// second factor.
+type MFAHandler struct {
+	cfg         *config.Config
+	firebase    *firebase.Firebase
+	revocations *revocation.List
+	auth        *AuthHandler
+}
+
+func NewMFAHandler(cfg *config.Config, fb *firebase.Firebase, revocations *revocation.List, auth *AuthHandler) *MFAHandler {
+	return &MFAHandler{
+		cfg:         cfg,
+		firebase:    fb,
+		revocations: revocations,
+		auth:        auth,
+	}
+}
+
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	totp, err := h.firebase.GetTOTP(ctx, userID)
+	if errors.Is(err, firebase.ErrTOTPNotFound) {
+		c.JSON(http.StatusOK, models.MFAStatusResponse{})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to fetch MFA status", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFAStatusResponse{
+		TOTPEnabled:            totp.Enabled,
+		RecoveryCodesRemaining: len(totp.RecoveryCodes),
+	})
+}
+
+// EnrollTOTP generates a new secret. It does not take effect until confirmed
+// with a code, so an abandoned enrollment cannot lock the user out.
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	email, _ := middleware.GetUserEmail(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	existing, err := h.firebase.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, firebase.ErrTOTPNotFound) {
+		respondInternalError(c, "Failed to enroll TOTP", err)
+		return
+	}
+	if existing != nil && existing.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		respondInternalError(c, "Failed to enroll TOTP", err)
+		return
+	}
+
+	err = h.firebase.SaveTOTP(ctx, userID, models.TOTP{
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		respondInternalError(c, "Failed to enroll TOTP", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(h.cfg.MFAIssuer, email, secret),
+	})
+}
+
+// ConfirmTOTP enables a pending enrollment once the user proves their app
+// generates valid codes, and returns the recovery codes. They are only shown
+// this once.
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		respondInternalError(c, "Failed to generate recovery codes", err)
+		return
+	}
+
+	var result secondFactorResult
+	err = h.firebase.UpdateTOTP(ctx, userID, func(totp *models.TOTP) error {
+		if totp.Enabled {
+			return errTOTPAlreadyEnabled
+		}
+		result = checkTOTPCode(totp, req.Code, time.Now())
+		if result == secondFactorValid {
+			now := time.Now()
+			totp.Enabled = true
+			totp.EnabledAt = &now
+			totp.RecoveryCodes = hashes
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, firebase.ErrTOTPNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Start TOTP enrollment first"})
+		return
+	case errors.Is(err, errTOTPAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is already enabled"})
+		return
+	case err != nil:
+		respondInternalError(c, "Failed to confirm TOTP", err)
+		return
+	}
+	if !respondSecondFactorResult(c, result) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, invalidating the old
+// ones.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		respondInternalError(c, "Failed to generate recovery codes", err)
+		return
+	}
+
+	var result secondFactorResult
+	err = h.firebase.UpdateTOTP(ctx, userID, func(totp *models.TOTP) error {
+		if !totp.Enabled {
+			return firebase.ErrTOTPNotFound
+		}
+		result = checkTOTPCode(totp, req.Code, time.Now())
+		if result == secondFactorValid {
+			totp.RecoveryCodes = hashes
+		}
+		return nil
+	})
+	if errors.Is(err, firebase.ErrTOTPNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TOTP is not enabled"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to regenerate recovery codes", err)
+		return
+	}
+	if !respondSecondFactorResult(c, result) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP removes the enrollment. It takes an app code or a recovery
+// code, so a stolen access token alone cannot turn MFA off.
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	result, err := h.checkSecondFactor(ctx, userID, req.Code)
+	if errors.Is(err, firebase.ErrTOTPNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TOTP is not enabled"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to disable TOTP", err)
+		return
+	}
+	if !respondSecondFactorResult(c, result) {
+		return
+	}
+
+	if err := h.firebase.DeleteTOTP(ctx, userID); err != nil {
+		respondInternalError(c, "Failed to disable TOTP", err)
+		return
+	}
+
+	h.auth.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditTOTPDisable,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "TOTP disabled successfully",
+	})
+}
+
+// Verify completes a login that returned an MFA challenge.
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.ValidateMFAToken(req.MFAToken, h.cfg.JWTKeys)
+	if err != nil || h.revocations.IsRevoked(claims) {
+		metrics.AuthFailed("mfa")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	result, err := h.checkSecondFactor(ctx, claims.UserID, req.Code)
+	if errors.Is(err, firebase.ErrTOTPNotFound) {
+		metrics.AuthFailed("mfa")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to verify code", err)
+		return
+	}
+	if !respondSecondFactorResult(c, result) {
+		metrics.AuthFailed("mfa")
+		return
+	}
+
+	// A challenge can only be completed once
+	if err := h.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		middleware.GetLogger(c).Error("Failed to persist revocation of MFA token", "tokenId", claims.ID, "error", err)
+	}
+
+	userData, err := h.firebase.GetUser(ctx, claims.UserID)
+	if err != nil {
+		metrics.AuthFailed("mfa")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	if status, _ := userData["status"].(string); status == models.UserDisabled {
+		metrics.AuthFailed("mfa")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been disabled"})
+		return
+	}
+
+	email, _ := userData["email"].(string)
+	name, _ := userData["name"].(string)
+	picture, _ := userData["picture"].(string)
+	role, _ := userData["role"].(string)
+
+	h.auth.issueTokens(c, ctx, models.User{
+		ID:      claims.UserID,
+		Email:   email,
+		Name:    name,
+		Picture: picture,
+		Role:    role,
+	}, "mfa")
+}
+
+// checkSecondFactor accepts either a code from the authenticator app or an
+// unused recovery code, which is consumed.
+func (h *MFAHandler) checkSecondFactor(ctx context.Context, userID, code string) (secondFactorResult, error) {
+	var result secondFactorResult
+	err := h.firebase.UpdateTOTP(ctx, userID, func(totp *models.TOTP) error {
+		if !totp.Enabled {
+			return firebase.ErrTOTPNotFound
+		}
+
+		now := time.Now()
+		if len(code) == 6 {
+			result = checkTOTPCode(totp, code, now)
+			return nil
+		}
+
+		if now.Before(totp.LockedUntil) {
+			result = secondFactorLocked
+			return nil
+		}
+		hash := utils.HashOpaqueToken(utils.NormalizeRecoveryCode(code))
+		for i, candidate := range totp.RecoveryCodes {
+			if candidate == hash {
+				totp.RecoveryCodes = append(totp.RecoveryCodes[:i], totp.RecoveryCodes[i+1:]...)
+				totp.FailedAttempts = 0
+				result = secondFactorValid
+				return nil
+			}
+		}
+		result = recordMFAFailure(totp, now)
+		return nil
+	})
+	return result, err
+}
+
+// checkTOTPCode validates an authenticator app code, applying the replay and
+// lockout rules to totp.
+func checkTOTPCode(totp *models.TOTP, code string, now time.Time) secondFactorResult {
+	if now.Before(totp.LockedUntil) {
+		return secondFactorLocked
+	}
+
+	step, ok := utils.ValidateTOTP(totp.Secret, code, now, totp.LastStep)
+	if !ok {
+		return recordMFAFailure(totp, now)
+	}
+
+	totp.LastStep = step
+	totp.FailedAttempts = 0
+	return secondFactorValid
+}
+
+func recordMFAFailure(totp *models.TOTP, now time.Time) secondFactorResult {
+	totp.FailedAttempts++
+	if totp.FailedAttempts >= maxMFAFailures {
+		totp.FailedAttempts = 0
+		totp.LockedUntil = now.Add(mfaLockout)
+	}
+	return secondFactorInvalid
+}
+
+// respondSecondFactorResult responds with an error and returns false unless
+// the code was valid.
+func respondSecondFactorResult(c *gin.Context, result secondFactorResult) bool {
+	switch result {
+	case secondFactorInvalid:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return false
+	case secondFactorLocked:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, please try again later"})
+		return false
+	}
+	return true
+}
+
+// generateRecoveryCodes returns new recovery codes and the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code
+		hashes[i] = utils.HashOpaqueToken(utils.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
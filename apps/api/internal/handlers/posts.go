@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"blog/api/internal/audit"
 	"blog/api/internal/database"
+	"blog/api/internal/logging"
+	"blog/api/internal/media"
 	"blog/api/internal/middleware"
 	"blog/api/internal/models"
+	"blog/api/internal/rbac"
 	"context"
 	"net/http"
 	"strconv"
@@ -16,15 +20,22 @@ import (
 )
 
 type PostsHandler struct {
-	db *database.MongoDB
+	db    *database.MongoDB
+	store *media.Store
+	audit *audit.Log
 }
 
-func NewPostsHandler(db *database.MongoDB) *PostsHandler {
-	return &PostsHandler{db: db}
+func NewPostsHandler(db *database.MongoDB, store *media.Store, auditLog *audit.Log) *PostsHandler {
+	return &PostsHandler{db: db, store: store, audit: auditLog}
 }
 
+// postAuditIgnore lists post fields that change on every write and would
+// only add noise to audit change summaries
+var postAuditIgnore = []string{"id", "createdAt", "updatedAt"}
+
 func (h *PostsHandler) GetPosts(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -54,14 +65,14 @@ func (h *PostsHandler) GetPosts(c *gin.Context) {
 
 	cursor, err := h.db.Posts().Find(ctx, filter, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+		respondInternalError(c, "Failed to fetch posts", err)
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var posts []models.Post
 	if err := cursor.All(ctx, &posts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode posts"})
+		respondInternalError(c, "Failed to decode posts", err)
 		return
 	}
 
@@ -71,6 +82,8 @@ func (h *PostsHandler) GetPosts(c *gin.Context) {
 		posts = posts[:limit]
 	}
 
+	h.attachCovers(ctx, posts)
+
 	c.JSON(http.StatusOK, models.PostsResponse{
 		Posts:   posts,
 		Page:    page,
@@ -80,7 +93,8 @@ func (h *PostsHandler) GetPosts(c *gin.Context) {
 }
 
 func (h *PostsHandler) SearchPosts(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 
 	// Get search query
 	query := c.Query("q")
@@ -111,14 +125,14 @@ func (h *PostsHandler) SearchPosts(c *gin.Context) {
 
 	cursor, err := h.db.Posts().Find(ctx, filter, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search posts"})
+		respondInternalError(c, "Failed to search posts", err)
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var posts []models.Post
 	if err := cursor.All(ctx, &posts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode posts"})
+		respondInternalError(c, "Failed to decode posts", err)
 		return
 	}
 
@@ -131,7 +145,8 @@ func (h *PostsHandler) SearchPosts(c *gin.Context) {
 }
 
 func (h *PostsHandler) GetPost(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 	id := c.Param("id")
 
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -148,11 +163,15 @@ func (h *PostsHandler) GetPost(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, post)
+	posts := []models.Post{post}
+	h.attachCovers(ctx, posts)
+
+	c.JSON(http.StatusOK, posts[0])
 }
 
 func (h *PostsHandler) GetPostAdmin(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 	id := c.Param("id")
 
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -172,7 +191,11 @@ func (h *PostsHandler) GetPostAdmin(c *gin.Context) {
 }
 
 func (h *PostsHandler) CreatePost(c *gin.Context) {
-	ctx := context.Background()
+	// Importing external images stores them, which takes up to
+	// media.LocalizeTimeout for the content alone
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
 
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -191,11 +214,22 @@ func (h *PostsHandler) CreatePost(c *gin.Context) {
 		published = *req.Published
 	}
 
+	if published && !middleware.Can(c, rbac.PublishPosts) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to publish posts"})
+		return
+	}
+
 	imageURL := ""
 	if req.ImageURL != "" {
 		imageURL = req.ImageURL
 	}
 
+	// Import external images so the post does not hot-link them
+	if req.LocalizeImages {
+		req.Content = h.store.LocalizeContent(ctx, req.Content, userID)
+		imageURL = h.store.LocalizeURL(ctx, imageURL, userID)
+	}
+
 	now := time.Now()
 	post := models.Post{
 		ID:        primitive.NewObjectID(),
@@ -211,15 +245,30 @@ func (h *PostsHandler) CreatePost(c *gin.Context) {
 
 	_, err := h.db.Posts().InsertOne(ctx, post)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
+		respondInternalError(c, "Failed to create post", err)
 		return
 	}
 
+	if post.Published {
+		h.publishMedia(ctx, &post)
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditPostCreate,
+		TargetType: models.AuditTargetPost,
+		TargetID:   post.ID.Hex(),
+		Changes:    audit.Diff(nil, post, postAuditIgnore...),
+	})
+
 	c.JSON(http.StatusCreated, post)
 }
 
 func (h *PostsHandler) UpdatePost(c *gin.Context) {
-	ctx := context.Background()
+	// Importing external images stores them, which takes up to
+	// media.LocalizeTimeout for the content alone
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
 	id := c.Param("id")
 
 	userID, ok := middleware.GetUserID(c)
@@ -234,7 +283,7 @@ func (h *PostsHandler) UpdatePost(c *gin.Context) {
 		return
 	}
 
-	// Check if post exists and user is the author
+	// Check if post exists and user may edit it
 	var existingPost models.Post
 	err = h.db.Posts().FindOne(ctx, bson.M{"_id": objectID}).Decode(&existingPost)
 	if err != nil {
@@ -242,8 +291,8 @@ func (h *PostsHandler) UpdatePost(c *gin.Context) {
 		return
 	}
 
-	if existingPost.AuthorID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own posts"})
+	if !canModifyPost(c, existingPost, userID, rbac.EditAnyPost) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this post"})
 		return
 	}
 
@@ -253,19 +302,32 @@ func (h *PostsHandler) UpdatePost(c *gin.Context) {
 		return
 	}
 
+	if req.Published != nil && *req.Published != existingPost.Published && !middleware.Can(c, rbac.PublishPosts) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to publish posts"})
+		return
+	}
+
 	// Build update document
 	update := bson.M{"updatedAt": time.Now()}
 	if req.Title != nil {
 		update["title"] = *req.Title
 	}
 	if req.Content != nil {
-		update["content"] = *req.Content
+		content := *req.Content
+		if req.LocalizeImages {
+			content = h.store.LocalizeContent(ctx, content, userID)
+		}
+		update["content"] = content
 	}
 	if req.Summary != nil {
 		update["summary"] = *req.Summary
 	}
 	if req.ImageURL != nil {
-		update["imageUrl"] = *req.ImageURL
+		imageURL := *req.ImageURL
+		if req.LocalizeImages {
+			imageURL = h.store.LocalizeURL(ctx, imageURL, userID)
+		}
+		update["imageUrl"] = imageURL
 	}
 	if req.Published != nil {
 		update["published"] = *req.Published
@@ -277,7 +339,7 @@ func (h *PostsHandler) UpdatePost(c *gin.Context) {
 		bson.M{"$set": update},
 	)
 	if err != nil || result.MatchedCount == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+		respondInternalError(c, "Failed to update post", err)
 		return
 	}
 
@@ -285,15 +347,27 @@ func (h *PostsHandler) UpdatePost(c *gin.Context) {
 	var updatedPost models.Post
 	err = h.db.Posts().FindOne(ctx, bson.M{"_id": objectID}).Decode(&updatedPost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated post"})
+		respondInternalError(c, "Failed to fetch updated post", err)
 		return
 	}
 
+	if updatedPost.Published {
+		h.publishMedia(ctx, &updatedPost)
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditPostUpdate,
+		TargetType: models.AuditTargetPost,
+		TargetID:   id,
+		Changes:    audit.Diff(existingPost, updatedPost, postAuditIgnore...),
+	})
+
 	c.JSON(http.StatusOK, updatedPost)
 }
 
 func (h *PostsHandler) DeletePost(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
 	id := c.Param("id")
 
 	userID, ok := middleware.GetUserID(c)
@@ -308,7 +382,7 @@ func (h *PostsHandler) DeletePost(c *gin.Context) {
 		return
 	}
 
-	// Check if post exists and user is the author
+	// Check if post exists and user may delete it
 	var existingPost models.Post
 	err = h.db.Posts().FindOne(ctx, bson.M{"_id": objectID}).Decode(&existingPost)
 	if err != nil {
@@ -316,18 +390,76 @@ func (h *PostsHandler) DeletePost(c *gin.Context) {
 		return
 	}
 
-	if existingPost.AuthorID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own posts"})
+	if !canModifyPost(c, existingPost, userID, rbac.DeleteAnyPost) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this post"})
 		return
 	}
 
 	result, err := h.db.Posts().DeleteOne(ctx, bson.M{"_id": objectID})
 	if err != nil || result.DeletedCount == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+		respondInternalError(c, "Failed to delete post", err)
 		return
 	}
 
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditPostDelete,
+		TargetType: models.AuditTargetPost,
+		TargetID:   id,
+		Changes:    audit.Diff(existingPost, nil, postAuditIgnore...),
+	})
+
 	c.JSON(http.StatusOK, models.MessageResponse{
 		Message: "Post deleted successfully",
 	})
 }
+
+// canModifyPost allows changes to any post with anyPermission, otherwise only
+// to the user's own posts. Published posts additionally require the right to
+// publish, so contributors cannot alter what they could not have published.
+func canModifyPost(c *gin.Context, post models.Post, userID string, anyPermission rbac.Permission) bool {
+	if middleware.Can(c, anyPermission) {
+		return true
+	}
+	if post.AuthorID != userID {
+		return false
+	}
+	return !post.Published || middleware.Can(c, rbac.PublishPosts)
+}
+
+// attachCovers sets the cover image placeholder on each post. Placeholders are
+// cosmetic, so lookup failures are logged rather than failing the request.
+func (h *PostsHandler) attachCovers(ctx context.Context, posts []models.Post) {
+	urls := make([]string, 0, len(posts))
+	for _, post := range posts {
+		if post.ImageURL != "" {
+			urls = append(urls, post.ImageURL)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+
+	placeholders, err := media.CoverPlaceholders(ctx, h.db, urls)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to load cover placeholders", "error", err)
+		return
+	}
+
+	for i := range posts {
+		posts[i].Cover = placeholders[posts[i].ImageURL]
+	}
+}
+
+// publishMedia makes private media referenced by a published post public so
+// readers can load it without a signed URL. Media merged into an existing
+// public copy has been relinked in the database; post is updated to match.
+func (h *PostsHandler) publishMedia(ctx context.Context, post *models.Post) {
+	replaced, err := h.store.PublishReferenced(ctx, post.Content, post.ImageURL)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to publish media for post", "postId", post.ID.Hex(), "error", err)
+	}
+	for oldURL, newURL := range replaced {
+		post.Content = media.ReplaceURL(post.Content, oldURL, newURL)
+		post.ImageURL = media.ReplaceURL(post.ImageURL, oldURL, newURL)
+	}
+}
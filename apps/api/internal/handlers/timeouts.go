@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"blog/api/internal/middleware"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers derive their context from the request, so a client that goes away
+// cancels the work done for it. These bound how long a stalled backend can
+// hold a request that is still connected.
+const (
+	// requestTimeout bounds the MongoDB, Firestore and login provider calls
+	// of an ordinary request
+	requestTimeout = 15 * time.Second
+	// storageTimeout bounds requests that move files to or from Cloud Storage
+	storageTimeout = 2 * time.Minute
+	// jobTimeout bounds maintenance passes run on demand
+	jobTimeout = 10 * time.Minute
+)
+
+// extendWriteDeadline lifts the server's write timeout for a response that can
+// legitimately take longer to send, such as a large file, an export or a
+// maintenance pass. The request's context still ends it when the client goes
+// away.
+func extendWriteDeadline(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		middleware.GetLogger(c).Warn("Failed to lift the write deadline", "error", err)
+	}
+}
+
+// extendReadDeadline lifts the server's read timeout for a request whose body
+// or handling can legitimately take longer, such as an upload. Once the body
+// is read the server keeps watching the connection, and a read deadline that
+// passes then cancels the request's context, so handlers that work longer
+// than the timeout after a small body need this too. The handler's own
+// timeout still bounds the work.
+func extendReadDeadline(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetReadDeadline(time.Time{}); err != nil {
+		middleware.GetLogger(c).Warn("Failed to lift the read deadline", "error", err)
+	}
+}
@@ -1,23 +1,41 @@
 package handlers
 
 import (
-	"blog/api/internal/firebase"
+	"blog/api/internal/audit"
+	"blog/api/internal/media"
+	"blog/api/internal/metrics"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UploadsHandler struct {
-	firebase *firebase.Firebase
+	store *media.Store
+	audit *audit.Log
 }
 
-func NewUploadsHandler(fb *firebase.Firebase) *UploadsHandler {
-	return &UploadsHandler{firebase: fb}
+func NewUploadsHandler(store *media.Store, auditLog *audit.Log) *UploadsHandler {
+	return &UploadsHandler{store: store, audit: auditLog}
 }
 
 func (h *UploadsHandler) UploadImage(c *gin.Context) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
 
 	// Get file from form
 	file, header, err := c.Request.FormFile("image")
@@ -28,32 +46,292 @@ func (h *UploadsHandler) UploadImage(c *gin.Context) {
 	defer file.Close()
 
 	// Validate file size (max 5MB)
-	if header.Size > 5*1024*1024 {
+	if header.Size > media.MaxImageSize {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds 5MB"})
 		return
 	}
 
-	// Validate file type
-	contentType := header.Header.Get("Content-Type")
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/gif":  true,
-		"image/webp": true,
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxImageSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image file"})
+		return
 	}
 
-	if !allowedTypes[contentType] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Allowed types: jpeg, jpg, png, gif, webp"})
+	item, deduplicated, err := h.store.SaveImage(ctx, media.ImageUpload{
+		Data:        data,
+		Filename:    header.Filename,
+		ContentType: header.Header.Get("Content-Type"),
+		AltText:     c.PostForm("altText"),
+		Caption:     c.PostForm("caption"),
+		Visibility:  c.PostForm("visibility"),
+		UploadedBy:  userID,
+	})
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	h.respondUpload(c, item, deduplicated)
+}
+
+func (h *UploadsHandler) UploadImageFromURL(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.UploadFromURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, deduplicated, err := h.store.ImportImage(ctx, req.URL, media.ImageUpload{
+		AltText:    req.AltText,
+		Caption:    req.Caption,
+		Visibility: req.Visibility,
+		UploadedBy: userID,
+	})
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	h.respondUpload(c, item, deduplicated)
+}
+
+func (h *UploadsHandler) CreateUploadSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Upload to Firebase Storage
-	url, err := h.firebase.UploadImage(ctx, file, header)
+	session, err := h.store.CreateSession(ctx, req, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
+		respondUploadError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"url": url})
+	c.Header("Location", "/uploads/sessions/"+session.ID.Hex())
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, session)
+}
+
+func (h *UploadsHandler) GetUploadSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload session ID"})
+		return
+	}
+
+	session, err := h.store.GetSession(ctx, sessionID, userID)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusOK, session)
+}
+
+// AppendUploadChunk appends the raw request body at the offset given in the
+// Upload-Offset header.
+func (h *UploadsHandler) AppendUploadChunk(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload session ID"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+
+	session, err := h.store.AppendChunk(ctx, sessionID, userID, offset, c.Request.Body)
+	if err != nil {
+		if errors.Is(err, media.ErrOffsetMismatch) {
+			c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "Upload offset does not match, resume from the returned offset",
+				"offset": session.Offset,
+			})
+			return
+		}
+		respondUploadError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *UploadsHandler) CompleteUploadSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload session ID"})
+		return
+	}
+
+	item, deduplicated, err := h.store.CompleteSession(ctx, sessionID, userID)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	h.respondUpload(c, item, deduplicated)
+}
+
+func (h *UploadsHandler) AbortUploadSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	extendReadDeadline(c)
+
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload session ID"})
+		return
+	}
+
+	if err := h.store.AbortSession(ctx, sessionID, userID); err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "Upload session aborted",
+	})
+}
+
+// respondUpload records the upload and returns the stored media. Non-public
+// media also gets a short-lived signed URL so the editor can preview it.
+func (h *UploadsHandler) respondUpload(c *gin.Context, item *models.Media, deduplicated bool) {
+	metrics.ObserveUpload(item.Size, deduplicated)
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditMediaUpload,
+		TargetType: models.AuditTargetMedia,
+		TargetID:   item.ID.Hex(),
+		Details: map[string]string{
+			"filename":     item.Filename,
+			"size":         strconv.FormatInt(item.Size, 10),
+			"deduplicated": strconv.FormatBool(deduplicated),
+		},
+	})
+
+	response := models.UploadResponse{
+		URL:          item.URL,
+		Media:        *item,
+		Deduplicated: deduplicated,
+	}
+
+	if item.Visibility != "" && item.Visibility != models.MediaPublic {
+		signedURL, _, err := h.store.SignedURL(item, media.DefaultSignedURLTTL)
+		if err == nil {
+			response.SignedURL = signedURL
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func respondUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, media.ErrImageTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds 5MB"})
+	case errors.Is(err, media.ErrUnsupportedType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Allowed types: jpeg, jpg, png, gif, webp"})
+	case errors.Is(err, media.ErrTooManyPixels):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Image dimensions exceed %d megapixels", media.MaxImagePixels/1_000_000)})
+	case errors.Is(err, media.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image file"})
+	case errors.Is(err, media.ErrInvalidURL),
+		errors.Is(err, media.ErrDisallowedDestination),
+		errors.Is(err, media.ErrTooManyRedirects),
+		errors.Is(err, media.ErrUnexpectedFetchStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import image: " + err.Error()})
+	case errors.Is(err, media.ErrUnsupportedFile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Allowed types: jpeg, png, gif, webp, pdf, mp4, webm, mp3, m4a, ogg, wav"})
+	case errors.Is(err, media.ErrFileTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds the limit for its type"})
+	case errors.Is(err, media.ErrChunkTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk size exceeds 8MB"})
+	case errors.Is(err, media.ErrChunkTooSmall):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chunks other than the last must be at least 256KB"})
+	case errors.Is(err, media.ErrTooManyChunks):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Uploads are limited to %d chunks", media.MaxUploadChunks)})
+	case errors.Is(err, media.ErrSizeExceeded),
+		errors.Is(err, media.ErrUploadIncomplete),
+		errors.Is(err, media.ErrChecksumMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, media.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+	case errors.Is(err, media.ErrSessionExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Upload session has expired"})
+	case errors.Is(err, media.ErrSessionCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload session is already completed"})
+	case errors.Is(err, media.ErrSessionCompleting):
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload session is being completed"})
+	case errors.Is(err, media.ErrInvalidVisibility):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility. Allowed values: public, private, restricted"})
+	case errors.Is(err, media.ErrDuplicateMedia):
+		c.JSON(http.StatusConflict, gin.H{"error": "An identical file with this visibility already exists"})
+	case errors.Is(err, media.ErrPrivateDisabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Private uploads are not configured"})
+	case errors.Is(err, media.ErrFetchFailed):
+		middleware.GetLogger(c).Warn("Failed to fetch remote image", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch remote image"})
+	default:
+		respondInternalError(c, "Failed to upload image", err)
+	}
 }
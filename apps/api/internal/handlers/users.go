@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"blog/api/internal/audit"
+	"blog/api/internal/firebase"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"blog/api/internal/revocation"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+type UsersHandler struct {
+	firebase    *firebase.Firebase
+	revocations *revocation.List
+	audit       *audit.Log
+}
+
+func NewUsersHandler(fb *firebase.Firebase, revocations *revocation.List, auditLog *audit.Log) *UsersHandler {
+	return &UsersHandler{
+		firebase:    fb,
+		revocations: revocations,
+		audit:       auditLog,
+	}
+}
+
+func (h *UsersHandler) ListUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	users, err := h.firebase.ListUsers(ctx)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch users", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// InviteUser adds an email to the allowlist so its owner can log in.
+func (h *UsersHandler) InviteUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var req models.InviteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.firebase.FindUserByEmail(ctx, req.Email)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+	if !errors.Is(err, firebase.ErrUserNotFound) {
+		respondInternalError(c, "Failed to invite user", err)
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.RoleContributor
+	}
+
+	user, err := h.firebase.InviteUser(ctx, req.Email, role)
+	if err != nil {
+		respondInternalError(c, "Failed to invite user", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditUserInvite,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Details:    map[string]string{"email": user.Email, "role": user.Role},
+	})
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// DisableUser blocks a user from logging in and ends all their sessions.
+func (h *UsersHandler) DisableUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+	userID := c.Param("id")
+
+	if currentID, _ := middleware.GetUserID(c); currentID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+		return
+	}
+
+	userData, err := h.firebase.GetUser(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if role, _ := userData["role"].(string); role == models.RoleOwner {
+		if !h.hasOtherOwner(ctx, c) {
+			return
+		}
+	}
+
+	err = h.firebase.CreateOrUpdateUser(ctx, userID, map[string]interface{}{
+		"status":     models.UserDisabled,
+		"disabledAt": time.Now(),
+	})
+	if err != nil {
+		respondInternalError(c, "Failed to disable user", err)
+		return
+	}
+
+	if err := h.revocations.RevokeUser(ctx, userID); err != nil {
+		middleware.GetLogger(c).Error("Failed to persist revocation of user", "targetUserId", userID, "error", err)
+	}
+	if _, err := h.firebase.DeleteUserSessions(ctx, userID); err != nil {
+		middleware.GetLogger(c).Error("Failed to delete sessions of user", "targetUserId", userID, "error", err)
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditUserDisable,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "User disabled successfully",
+	})
+}
+
+func (h *UsersHandler) EnableUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+	userID := c.Param("id")
+
+	userData, err := h.firebase.GetUser(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if status, _ := userData["status"].(string); status != models.UserDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not disabled"})
+		return
+	}
+
+	err = h.firebase.CreateOrUpdateUser(ctx, userID, map[string]interface{}{
+		"status":     models.UserActive,
+		"disabledAt": firestore.Delete,
+	})
+	if err != nil {
+		respondInternalError(c, "Failed to enable user", err)
+		return
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditUserEnable,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "User enabled successfully",
+	})
+}
+
+// UpdateUserRole assigns a role. The user's access tokens are revoked so the
+// new role applies on their next request instead of after the tokens expire.
+func (h *UsersHandler) UpdateUserRole(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+	userID := c.Param("id")
+
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userData, err := h.firebase.GetUser(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	currentRole, _ := userData["role"].(string)
+	if currentRole == models.RoleOwner && req.Role != models.RoleOwner {
+		if !h.hasOtherOwner(ctx, c) {
+			return
+		}
+	}
+
+	err = h.firebase.CreateOrUpdateUser(ctx, userID, map[string]interface{}{
+		"role": req.Role,
+	})
+	if err != nil {
+		respondInternalError(c, "Failed to update role", err)
+		return
+	}
+
+	if err := h.revocations.RevokeUser(ctx, userID); err != nil {
+		middleware.GetLogger(c).Error("Failed to persist revocation of user", "targetUserId", userID, "error", err)
+	}
+
+	h.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditUserRoleUpdate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Changes:    []models.FieldChange{{Field: "role", Old: currentRole, New: req.Role}},
+	})
+
+	user := models.User{ID: userID, Role: req.Role}
+	user.Status, _ = userData["status"].(string)
+	user.Email, _ = userData["email"].(string)
+	user.Name, _ = userData["name"].(string)
+	user.Picture, _ = userData["picture"].(string)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// hasOtherOwner keeps at least one active owner so roles can still be
+// managed. It responds with an error when the owner in question is the last.
+func (h *UsersHandler) hasOtherOwner(ctx context.Context, c *gin.Context) bool {
+	owners, err := h.firebase.CountUsersWithRole(ctx, models.RoleOwner)
+	if err != nil {
+		respondInternalError(c, "Failed to count owners", err)
+		return false
+	}
+	if owners <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last owner"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"blog/api/internal/firebase"
+	"blog/api/internal/metrics"
+	"blog/api/internal/middleware"
+	"blog/api/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// ceremonyTTL bounds how long a begun registration or login can be finished.
+const ceremonyTTL = 5 * time.Minute
+
+// WebAuthnHandler registers passkeys for signed-in users and logs users in
+// with them. A successful login issues the same tokens as GoogleLogin.
+type WebAuthnHandler struct {
+	firebase *firebase.Firebase
+	webauthn *webauthn.WebAuthn
+	auth     *AuthHandler
+}
+
+func NewWebAuthnHandler(fb *firebase.Firebase, wa *webauthn.WebAuthn, auth *AuthHandler) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		firebase: fb,
+		webauthn: wa,
+		auth:     auth,
+	}
+}
+
+// passkeyUser adapts a user and their passkeys to webauthn.User.
+type passkeyUser struct {
+	user     models.User
+	passkeys []models.Passkey
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return u.user.WebAuthnID
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, passkey := range u.passkeys {
+		credentials[i] = passkey.Credential
+	}
+	return credentials
+}
+
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	user, err := h.loadUser(ctx, userID)
+	if err != nil {
+		respondInternalError(c, "Failed to load user", err)
+		return
+	}
+
+	// Passkeys are discoverable credentials, so login needs no username;
+	// already registered authenticators are excluded
+	creation, session, err := h.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		respondInternalError(c, "Failed to begin registration", err)
+		return
+	}
+
+	ceremonyID, err := h.saveCeremony(ctx, models.CeremonyRegistration, userID, session)
+	if err != nil {
+		respondInternalError(c, "Failed to begin registration", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.WebAuthnBeginResponse{
+		CeremonyID: ceremonyID,
+		Options:    creation,
+	})
+}
+
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	session, ok := h.takeCeremony(c, ctx, req.CeremonyID, models.CeremonyRegistration, userID)
+	if !ok {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	user, err := h.loadUser(ctx, userID)
+	if err != nil {
+		respondInternalError(c, "Failed to load user", err)
+		return
+	}
+
+	credential, err := h.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		middleware.GetLogger(c).Warn("Passkey registration failed", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey := models.Passkey{
+		ID:         base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:       name,
+		Credential: *credential,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.firebase.SavePasskey(ctx, userID, passkey); err != nil {
+		respondInternalError(c, "Failed to save passkey", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	// Requiring user verification (PIN or biometrics) makes the passkey a
+	// second factor on its own, so these logins skip the TOTP challenge
+	assertion, session, err := h.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		respondInternalError(c, "Failed to begin login", err)
+		return
+	}
+
+	ceremonyID, err := h.saveCeremony(ctx, models.CeremonyLogin, "", session)
+	if err != nil {
+		respondInternalError(c, "Failed to begin login", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.WebAuthnBeginResponse{
+		CeremonyID: ceremonyID,
+		Options:    assertion,
+	})
+}
+
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req models.WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	session, ok := h.takeCeremony(c, ctx, req.CeremonyID, models.CeremonyLogin, "")
+	if !ok {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	// The authenticator tells us whose passkey it is through the user handle
+	var owner *passkeyUser
+	_, credential, err := h.webauthn.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := h.firebase.FindUserByWebAuthnID(ctx, userHandle)
+		if err != nil {
+			return nil, err
+		}
+		passkeys, err := h.firebase.ListPasskeys(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		owner = &passkeyUser{user: *user, passkeys: passkeys}
+		return owner, nil
+	}, *session, parsed)
+	if err != nil {
+		middleware.GetLogger(c).Warn("Passkey login failed", "error", err)
+		metrics.AuthFailed("passkey")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	// A signature counter that went backwards means the key may have been
+	// cloned
+	if credential.Authenticator.CloneWarning {
+		middleware.GetLogger(c).Warn("Rejected passkey login, signature counter went backwards", "passkeyUserId", owner.user.ID)
+		metrics.AuthFailed("passkey")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	if !owner.user.IsActive() {
+		metrics.AuthFailed("passkey")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been disabled"})
+		return
+	}
+
+	// Persist the new signature counter and flags
+	passkeyID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for _, passkey := range owner.passkeys {
+		if passkey.ID != passkeyID {
+			continue
+		}
+		now := time.Now()
+		passkey.Credential = *credential
+		passkey.LastUsedAt = &now
+		if err := h.firebase.SavePasskey(ctx, owner.user.ID, passkey); err != nil {
+			respondInternalError(c, "Failed to save passkey", err)
+			return
+		}
+	}
+
+	err = h.firebase.CreateOrUpdateUser(ctx, owner.user.ID, map[string]interface{}{
+		"lastLoginAt": time.Now(),
+	})
+	if err != nil {
+		respondInternalError(c, "Failed to create/update user", err)
+		return
+	}
+
+	h.auth.issueTokens(c, ctx, models.User{
+		ID:      owner.user.ID,
+		Email:   owner.user.Email,
+		Name:    owner.user.Name,
+		Picture: owner.user.Picture,
+		Role:    owner.user.Role,
+	}, "passkey")
+}
+
+func (h *WebAuthnHandler) ListPasskeys(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	passkeys, err := h.firebase.ListPasskeys(ctx, userID)
+	if err != nil {
+		respondInternalError(c, "Failed to fetch passkeys", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, passkeys)
+}
+
+func (h *WebAuthnHandler) DeletePasskey(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	passkeyID := c.Param("id")
+	err := h.firebase.DeletePasskey(ctx, userID, passkeyID)
+	if errors.Is(err, firebase.ErrPasskeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, "Failed to delete passkey", err)
+		return
+	}
+
+	h.auth.audit.Record(c, models.AuditEntry{
+		Action:     models.AuditPasskeyDelete,
+		TargetType: models.AuditTargetPasskey,
+		TargetID:   passkeyID,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Message: "Passkey deleted successfully",
+	})
+}
+
+// loadUser returns the user with their passkeys, giving them a user handle if
+// they do not have one yet.
+func (h *WebAuthnHandler) loadUser(ctx context.Context, userID string) (*passkeyUser, error) {
+	handle, err := h.firebase.EnsureWebAuthnID(ctx, userID, newUserHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	userData, err := h.firebase.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	email, _ := userData["email"].(string)
+	name, _ := userData["name"].(string)
+
+	passkeys, err := h.firebase.ListPasskeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &passkeyUser{
+		user: models.User{
+			ID:         userID,
+			Email:      email,
+			Name:       name,
+			WebAuthnID: handle,
+		},
+		passkeys: passkeys,
+	}, nil
+}
+
+func (h *WebAuthnHandler) saveCeremony(ctx context.Context, kind, userID string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	ceremony := models.WebAuthnCeremony{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		UserID:    userID,
+		Session:   data,
+		ExpiresAt: time.Now().Add(ceremonyTTL),
+	}
+	if err := h.firebase.CreateWebAuthnCeremony(ctx, ceremony); err != nil {
+		return "", err
+	}
+	return ceremony.ID, nil
+}
+
+// takeCeremony consumes a ceremony and returns its session data. It responds
+// with an error and returns false if the ceremony cannot be used.
+func (h *WebAuthnHandler) takeCeremony(c *gin.Context, ctx context.Context, id, kind, userID string) (*webauthn.SessionData, bool) {
+	ceremony, err := h.firebase.TakeWebAuthnCeremony(ctx, id, kind, userID)
+	switch {
+	case errors.Is(err, firebase.ErrCeremonyNotFound), errors.Is(err, firebase.ErrCeremonyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown ceremony"})
+		return nil, false
+	case errors.Is(err, firebase.ErrCeremonyExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ceremony has expired, please try again"})
+		return nil, false
+	case err != nil:
+		respondInternalError(c, "Failed to load ceremony", err)
+		return nil, false
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(ceremony.Session, &session); err != nil {
+		respondInternalError(c, "Failed to load ceremony", err)
+		return nil, false
+	}
+	return &session, true
+}
+
+// newUserHandle generates a random WebAuthn user handle. The spec caps handles
+// at 64 bytes and forbids personal data in them.
+func newUserHandle() ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
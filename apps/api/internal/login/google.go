@@ -0,0 +1,57 @@
+package login
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/idtoken"
+)
+
+// GoogleProvider verifies Google ID tokens. Google users are keyed by their
+// bare subject, as they were before other providers existed.
+type GoogleProvider struct {
+	clientID string
+}
+
+func NewGoogleProvider(clientID string) *GoogleProvider {
+	return &GoogleProvider{clientID: clientID}
+}
+
+func (p *GoogleProvider) Name() string {
+	return "google"
+}
+
+func (p *GoogleProvider) Info() ProviderInfo {
+	return ProviderInfo{
+		Name:     p.Name(),
+		Type:     "google",
+		ClientID: p.clientID,
+	}
+}
+
+func (p *GoogleProvider) Authenticate(ctx context.Context, credential Credential) (*Identity, error) {
+	if credential.Token == "" {
+		return nil, ErrInvalidCredential
+	}
+
+	payload, err := idtoken.Validate(ctx, credential.Token, p.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	if email == "" {
+		return nil, fmt.Errorf("%w: token has no email", ErrInvalidCredential)
+	}
+	verified, _ := payload.Claims["email_verified"].(bool)
+	name, _ := payload.Claims["name"].(string)
+	picture, _ := payload.Claims["picture"].(string)
+
+	return &Identity{
+		UserID:        payload.Subject,
+		Email:         email,
+		EmailVerified: verified,
+		Name:          name,
+		Picture:       picture,
+	}, nil
+}
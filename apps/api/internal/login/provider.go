@@ -0,0 +1,73 @@
+package login
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrInvalidCredential = errors.New("invalid login credential")
+	ErrUnknownProvider   = errors.New("unknown login provider")
+)
+
+// Identity is the user a provider vouched for.
+type Identity struct {
+	// UserID is the key of the user in the users store
+	UserID        string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Credential is what the client obtained from the provider: either an ID
+// token, or an authorization code to be exchanged by the API.
+type Credential struct {
+	Token        string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+}
+
+// Provider verifies a login credential and returns the identity behind it.
+type Provider interface {
+	Name() string
+	Authenticate(ctx context.Context, credential Credential) (*Identity, error)
+	Info() ProviderInfo
+}
+
+// ProviderInfo is what clients need to start a login with a provider.
+type ProviderInfo struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Issuer   string   `json:"issuer,omitempty"`
+	ClientID string   `json:"clientId"`
+	AuthURL  string   `json:"authUrl,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers []Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+func (r *Registry) Infos() []ProviderInfo {
+	infos := make([]ProviderInfo, 0, len(r.providers))
+	for _, p := range r.providers {
+		infos = append(infos, p.Info())
+	}
+	return infos
+}
@@ -0,0 +1,122 @@
+package media
+
+import (
+	"blog/api/internal/database"
+	"blog/api/internal/firebase"
+	"blog/api/internal/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxBackfillImageSize caps the covers read for backfilling. They may predate
+// the upload size limit, so it is more generous.
+const maxBackfillImageSize = 4 * MaxImageSize
+
+// BackfillPlaceholders computes placeholders for post cover images uploaded
+// before placeholders were generated at upload time. Covers without a media
+// record get one created from the stored object; external URLs are skipped.
+func BackfillPlaceholders(ctx context.Context, db *database.MongoDB, fb *firebase.Firebase) (*models.PlaceholderBackfillReport, error) {
+	report := &models.PlaceholderBackfillReport{
+		Failed: []models.PlaceholderBackfillFailure{},
+	}
+
+	filter := bson.M{"imageUrl": bson.M{"$ne": ""}}
+	opts := options.Find().SetProjection(bson.M{"imageUrl": 1, "authorId": 1})
+	cursor, err := db.Posts().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+
+	for _, post := range posts {
+		report.Processed++
+
+		objectPaths := ExtractObjectPaths(post.ImageURL)
+		if len(objectPaths) == 0 {
+			report.Skipped++
+			continue
+		}
+		objectPath := objectPaths[0]
+
+		var existing models.Media
+		err := db.Media().FindOne(ctx, bson.M{"path": objectPath}).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		found := err == nil
+		if found && existing.BlurHash != "" {
+			report.Skipped++
+			continue
+		}
+
+		if err := backfillObject(ctx, db, fb, post, objectPath, found); err != nil {
+			report.Failed = append(report.Failed, models.PlaceholderBackfillFailure{
+				PostID: post.ID,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		report.Updated++
+	}
+
+	return report, nil
+}
+
+func backfillObject(ctx context.Context, db *database.MongoDB, fb *firebase.Firebase, post models.Post, objectPath string, found bool) error {
+	data, contentType, err := fb.ReadObject(ctx, objectPath, maxBackfillImageSize)
+	if err != nil {
+		return err
+	}
+
+	placeholder, err := ComputePlaceholder(data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if found {
+		_, err = db.Media().UpdateOne(ctx,
+			bson.M{"path": objectPath},
+			bson.M{"$set": bson.M{
+				"blurHash":      placeholder.BlurHash,
+				"dominantColor": placeholder.DominantColor,
+				"width":         placeholder.Width,
+				"height":        placeholder.Height,
+				"updatedAt":     now,
+			}},
+		)
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	_, err = db.Media().InsertOne(ctx, models.Media{
+		ID:            primitive.NewObjectID(),
+		Path:          objectPath,
+		URL:           post.ImageURL,
+		Filename:      ObjectKey(objectPath),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		Width:         placeholder.Width,
+		Height:        placeholder.Height,
+		BlurHash:      placeholder.BlurHash,
+		DominantColor: placeholder.DominantColor,
+		Hash:          hex.EncodeToString(sum[:]),
+		RefCount:      1,
+		UploadedBy:    post.AuthorID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	return err
+}
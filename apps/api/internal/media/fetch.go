@@ -0,0 +1,181 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+)
+
+const (
+	fetchTimeout      = 15 * time.Second
+	fetchMaxRedirects = 3
+)
+
+var (
+	ErrInvalidURL            = errors.New("only absolute http and https URLs can be imported")
+	ErrDisallowedDestination = errors.New("URL resolves to a disallowed network address")
+	ErrTooManyRedirects      = errors.New("too many redirects")
+	ErrUnexpectedFetchStatus = errors.New("remote server returned an unexpected status")
+	ErrFetchFailed           = errors.New("failed to fetch remote image")
+	errDisallowedDialAddress = errors.New("disallowed dial address")
+)
+
+var extensionsByImageType = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/jpg":  ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Fetcher downloads remote images with size, time and redirect limits. The
+// dialer refuses private, loopback and link-local addresses after DNS
+// resolution, so neither the original URL nor a redirect can reach internal
+// services.
+type Fetcher struct {
+	client *http.Client
+}
+
+func NewFetcher() *Fetcher {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !isPublicAddr(addrPort.Addr()) {
+				return errDisallowedDialAddress
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// Never route through an environment proxy, the proxy would do the
+		// resolving and bypass the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   fetchTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= fetchMaxRedirects {
+					return ErrTooManyRedirects
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return ErrInvalidURL
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// FetchImage downloads an image and returns it as an upload ready to be
+// passed to Store.SaveImage.
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) (*ImageUpload, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, errDisallowedDialAddress) {
+			return nil, ErrDisallowedDestination
+		}
+		if errors.Is(err, ErrTooManyRedirects) || errors.Is(err, ErrInvalidURL) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", ErrUnexpectedFetchStatus, resp.StatusCode)
+	}
+	if resp.ContentLength > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	if len(data) > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+
+	// Trust the declared type only when it is one we accept, otherwise sniff
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !IsAllowedImageType(contentType) {
+		contentType = http.DetectContentType(data)
+	}
+
+	filename := path.Base(resp.Request.URL.Path)
+	if path.Ext(filename) == "" || filename == "/" || filename == "." {
+		filename = "image" + extensionsByImageType[contentType]
+	}
+
+	return &ImageUpload{
+		Data:        data,
+		Filename:    filename,
+		ContentType: contentType,
+	}, nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ranges that the netip predicates above do not cover
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	// Transition mechanisms that embed an IPv4 address, which could be a
+	// private one: local-use NAT64, Teredo and 6to4
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
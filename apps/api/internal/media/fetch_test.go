@@ -0,0 +1,72 @@
+package media
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		// Public
+		{"8.8.8.8", true},
+		{"142.250.74.46", true},
+		{"2001:4860:4860::8888", true},
+		{"::ffff:8.8.8.8", true},
+
+		// Loopback and unspecified
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+
+		// Private
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+
+		// Link-local, including cloud metadata endpoints
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+
+		// IPv4 addresses mapped into IPv6
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+
+		// Multicast
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+
+		// Reserved ranges
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"64:ff9b::7f00:1", false},
+		{"2001:db8::1", false},
+
+		// IPv6 transition prefixes embedding an IPv4 address
+		{"64:ff9b:1::a00:1", false},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", false},
+		{"2002:7f00:1::", false},
+		{"2002:a9fe:a9fe::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	if isPublicAddr(netip.Addr{}) {
+		t.Error("isPublicAddr accepts the zero address")
+	}
+}
@@ -0,0 +1,201 @@
+package media
+
+import (
+	"blog/api/internal/database"
+	"blog/api/internal/firebase"
+	"blog/api/internal/models"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const quarantineMetadataKey = "quarantinedAt"
+
+var ErrCollectionRunning = errors.New("media garbage collection is already running")
+
+// Collector removes uploaded images that are no longer referenced by any post
+// or about content. Unreferenced objects are first quarantined and only
+// deleted once the quarantine period has elapsed, so an image that is put
+// back into a post in the meantime is restored instead of lost.
+type Collector struct {
+	db         *database.MongoDB
+	firebase   *firebase.Firebase
+	store      *Store
+	quarantine time.Duration
+	minAge     time.Duration
+	mu         sync.Mutex
+}
+
+func NewCollector(store *Store, quarantine, minAge time.Duration) *Collector {
+	return &Collector{
+		db:         store.db,
+		firebase:   store.firebase,
+		store:      store,
+		quarantine: quarantine,
+		minAge:     minAge,
+	}
+}
+
+// Start runs the collector every interval until ctx is cancelled.
+func (c *Collector) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Collect(ctx, false)
+			if err != nil {
+				slog.Error("Media GC failed", "error", err)
+				continue
+			}
+			slog.Info("Media GC finished",
+				"scanned", report.Scanned,
+				"quarantined", len(report.Quarantined),
+				"deleted", len(report.Deleted),
+				"restored", len(report.Restored))
+		}
+	}
+}
+
+// Collect performs a single collection pass. With dryRun set it only reports
+// what would happen without touching storage.
+func (c *Collector) Collect(ctx context.Context, dryRun bool) (*models.GCReport, error) {
+	if !c.mu.TryLock() {
+		return nil, ErrCollectionRunning
+	}
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	report := &models.GCReport{
+		DryRun:      dryRun,
+		StartedAt:   now,
+		Quarantined: []models.GCObject{},
+		Pending:     []models.GCObject{},
+		Restored:    []models.GCObject{},
+		Deleted:     []models.GCObject{},
+	}
+
+	referenced, err := ReferencedObjectKeys(ctx, c.db)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := c.firebase.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attrs := range objects {
+		report.Scanned++
+
+		object := models.GCObject{
+			Path:      attrs.Name,
+			Size:      attrs.Size,
+			CreatedAt: attrs.Created,
+		}
+		if value, ok := attrs.Metadata[quarantineMetadataKey]; ok {
+			if quarantinedAt, err := time.Parse(time.RFC3339, value); err == nil {
+				object.QuarantinedAt = &quarantinedAt
+			}
+		}
+
+		if referenced[ObjectKey(attrs.Name)] {
+			report.Referenced++
+			if object.QuarantinedAt != nil {
+				if !dryRun {
+					if err := c.restore(ctx, attrs.Name); err != nil {
+						return nil, err
+					}
+				}
+				report.Restored = append(report.Restored, object)
+			}
+			continue
+		}
+
+		// Leave fresh uploads alone, they probably belong to an editor
+		// session that has not been saved yet
+		if now.Sub(attrs.Created) < c.minAge {
+			report.TooRecent++
+			continue
+		}
+
+		switch {
+		case c.quarantine > 0 && object.QuarantinedAt == nil:
+			if !dryRun {
+				if err := c.markQuarantined(ctx, attrs.Name, now); err != nil {
+					return nil, err
+				}
+			}
+			object.QuarantinedAt = &now
+			report.Quarantined = append(report.Quarantined, object)
+		case c.quarantine > 0 && now.Sub(*object.QuarantinedAt) < c.quarantine:
+			report.Pending = append(report.Pending, object)
+		default:
+			if !dryRun {
+				if err := c.delete(ctx, attrs.Name); err != nil {
+					return nil, err
+				}
+			}
+			report.Deleted = append(report.Deleted, object)
+			report.FreedBytes += object.Size
+		}
+	}
+
+	// Abandoned resumable uploads leave their chunks behind as well
+	if !dryRun {
+		expired, err := c.store.CleanupExpiredSessions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.ExpiredSessions = expired
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+func (c *Collector) markQuarantined(ctx context.Context, objectPath string, at time.Time) error {
+	metadata := map[string]string{quarantineMetadataKey: at.UTC().Format(time.RFC3339)}
+	if err := c.firebase.UpdateImageMetadata(ctx, objectPath, metadata); err != nil {
+		return err
+	}
+	_, err := c.db.Media().UpdateOne(ctx,
+		bson.M{"path": objectPath},
+		bson.M{"$set": bson.M{"quarantinedAt": at}},
+	)
+	return err
+}
+
+func (c *Collector) restore(ctx context.Context, objectPath string) error {
+	// An empty value removes the metadata key
+	metadata := map[string]string{quarantineMetadataKey: ""}
+	if err := c.firebase.UpdateImageMetadata(ctx, objectPath, metadata); err != nil {
+		return err
+	}
+	_, err := c.db.Media().UpdateOne(ctx,
+		bson.M{"path": objectPath},
+		bson.M{"$unset": bson.M{"quarantinedAt": ""}},
+	)
+	// An identical upload made while this one was quarantined is now the
+	// live entry for the content; this entry stays out of deduplication
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *Collector) delete(ctx context.Context, objectPath string) error {
+	if err := c.firebase.DeleteObject(ctx, objectPath); err != nil {
+		return err
+	}
+	_, err := c.db.Media().DeleteOne(ctx, bson.M{"path": objectPath})
+	return err
+}
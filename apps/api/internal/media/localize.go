@@ -0,0 +1,133 @@
+package media
+
+import (
+	"blog/api/internal/logging"
+	"blog/api/internal/models"
+	"context"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var imgSrcPattern = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*)(["'])([^"']*)(["'])`)
+
+const (
+	// LocalizeTimeout bounds the time LocalizeContent spends importing the
+	// images of one text; images not imported by then keep their source
+	LocalizeTimeout = 30 * time.Second
+	// MaxLocalizedImages is the most distinct images imported from one text
+	MaxLocalizedImages = 20
+)
+
+// ImportImage fetches a remote image and stores it like a regular upload
+func (s *Store) ImportImage(ctx context.Context, rawURL string, upload ImageUpload) (*models.Media, bool, error) {
+	fetched, err := s.fetcher.FetchImage(ctx, rawURL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	upload.Data = fetched.Data
+	upload.Filename = fetched.Filename
+	upload.ContentType = fetched.ContentType
+	return s.SaveImage(ctx, upload)
+}
+
+// IsExternalImage reports whether src is an absolute http(s) URL that does
+// not point at an object in our storage.
+func (s *Store) IsExternalImage(src string) bool {
+	parsed, err := url.Parse(src)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	return !s.isStoredObjectURL(parsed)
+}
+
+// isStoredObjectURL reports whether u is a link to an object in our bucket,
+// either served by the API or by Cloud Storage. Other hosts are external
+// even when their paths look like ours.
+func (s *Store) isStoredObjectURL(u *url.URL) bool {
+	if len(ExtractObjectKeys(u.String())) == 0 {
+		return false
+	}
+
+	if api, err := url.Parse(s.apiURL); err == nil && strings.EqualFold(u.Host, api.Host) {
+		return strings.HasPrefix(u.Path, strings.TrimSuffix(api.Path, "/")+"/media/file/")
+	}
+
+	bucket := s.firebase.BucketName
+	if bucket == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	switch host {
+	case "storage.googleapis.com", "firebasestorage.googleapis.com":
+		// Path style links name the bucket as a path segment:
+		// /<bucket>/..., /download/storage/v1/b/<bucket>/o/... or /v0/b/<bucket>/o/...
+		for _, segment := range strings.Split(u.Path, "/") {
+			if segment == bucket {
+				return true
+			}
+		}
+		return false
+	default:
+		// Virtual hosted links and buckets on their own domain
+		return host == strings.ToLower(bucket)+".storage.googleapis.com" || host == strings.ToLower(bucket)
+	}
+}
+
+// LocalizeURL imports an external image and returns the URL of the stored
+// copy. Non-external URLs and failed imports return the original URL.
+func (s *Store) LocalizeURL(ctx context.Context, src, uploadedBy string) string {
+	if !s.IsExternalImage(src) {
+		return src
+	}
+
+	item, _, err := s.ImportImage(ctx, src, ImageUpload{UploadedBy: uploadedBy})
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to localize image", "src", src, "error", err)
+		return src
+	}
+	return item.URL
+}
+
+// LocalizeContent imports every external image referenced by an <img> tag
+// and rewrites the tags to point at the stored copies. Images that cannot be
+// imported, or that are beyond MaxLocalizedImages or LocalizeTimeout, keep
+// their original source.
+func (s *Store) LocalizeContent(ctx context.Context, content, uploadedBy string) string {
+	ctx, cancel := context.WithTimeout(ctx, LocalizeTimeout)
+	defer cancel()
+
+	localized := map[string]string{}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range imgSrcPattern.FindAllStringSubmatchIndex(content, -1) {
+		srcStart, srcEnd := match[6], match[7]
+		src := html.UnescapeString(content[srcStart:srcEnd])
+		if !s.IsExternalImage(src) {
+			continue
+		}
+
+		replacement, ok := localized[src]
+		if !ok {
+			if len(localized) >= MaxLocalizedImages || ctx.Err() != nil {
+				continue
+			}
+			replacement = s.LocalizeURL(ctx, src, uploadedBy)
+			localized[src] = replacement
+		}
+		if replacement == src {
+			continue
+		}
+
+		b.WriteString(content[last:srcStart])
+		b.WriteString(html.EscapeString(replacement))
+		last = srcEnd
+	}
+	b.WriteString(content[last:])
+
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"blog/api/internal/models"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/buckket/go-blurhash"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// Images are downscaled before hashing, a BlurHash only keeps a few
+	// frequency components so the full resolution adds nothing but cost
+	placeholderSampleSize = 64
+	blurHashComponentsX   = 4
+	blurHashComponentsY   = 3
+	// MaxImagePixels caps the dimensions of images that are decoded. Small
+	// files can declare huge dimensions and would take gigabytes to decode.
+	MaxImagePixels = 40_000_000
+)
+
+var ErrTooManyPixels = errors.New("image dimensions exceed the maximum")
+
+// ComputePlaceholder decodes an image and returns its intrinsic dimensions,
+// BlurHash and dominant color. It fails for data that is not a supported image.
+func ComputePlaceholder(data []byte) (*models.ImagePlaceholder, error) {
+	// Check the declared dimensions before allocating anything for them
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	sample := downscale(img, placeholderSampleSize)
+
+	hash, err := blurhash.Encode(blurHashComponentsX, blurHashComponentsY, sample)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ImagePlaceholder{
+		BlurHash:      hash,
+		DominantColor: dominantColor(sample),
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+	}, nil
+}
+
+func downscale(img image.Image, maxSize int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > height && width > maxSize {
+		height = max(1, height*maxSize/width)
+		width = maxSize
+	} else if height > maxSize {
+		width = max(1, width*maxSize/height)
+		height = maxSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// dominantColor buckets pixels into a coarse 4-bit-per-channel histogram and
+// returns the average color of the most populated bucket as a hex string.
+func dominantColor(img *image.RGBA) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := map[int]*bucket{}
+	var best *bucket
+
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b, a := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2]), img.Pix[i+3]
+		// Skip mostly transparent pixels, they would pull the color to black
+		if a < 128 {
+			continue
+		}
+
+		key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.count++
+		bk.r += r
+		bk.g += g
+		bk.b += b
+
+		if best == nil || bk.count > best.count {
+			best = bk
+		}
+	}
+
+	if best == nil {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
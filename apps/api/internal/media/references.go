@@ -0,0 +1,136 @@
+package media
+
+import (
+	"blog/api/internal/database"
+	"blog/api/internal/models"
+	"context"
+	"path"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// objectNamePattern matches stored object names in both plain paths
+// ("images/<uuid>.png") and URL-encoded storage links ("images%2F<uuid>.png").
+var objectNamePattern = regexp.MustCompile(`(images|attachments)(?:/|%2F|%2f)([A-Za-z0-9-]+\.[A-Za-z0-9]+)`)
+
+// ObjectKey returns the key used to match an object path against references.
+func ObjectKey(objectPath string) string {
+	return path.Base(objectPath)
+}
+
+// ExtractObjectKeys returns the keys of every stored object referenced in text.
+func ExtractObjectKeys(text string) []string {
+	var keys []string
+	for _, match := range objectNamePattern.FindAllStringSubmatch(text, -1) {
+		keys = append(keys, match[2])
+	}
+	return keys
+}
+
+// ExtractObjectPaths returns the paths of every stored object referenced in text.
+func ExtractObjectPaths(text string) []string {
+	var paths []string
+	for _, match := range objectNamePattern.FindAllStringSubmatch(text, -1) {
+		paths = append(paths, match[1]+"/"+match[2])
+	}
+	return paths
+}
+
+// ReferencedObjectKeys scans post content, post cover images and about
+// content and returns the set of object keys they reference.
+func ReferencedObjectKeys(ctx context.Context, db *database.MongoDB) (map[string]bool, error) {
+	referenced := map[string]bool{}
+
+	opts := options.Find().SetProjection(bson.M{"content": 1, "imageUrl": 1})
+	cursor, err := db.Posts().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var post models.Post
+		if err := cursor.Decode(&post); err != nil {
+			return nil, err
+		}
+		for _, key := range ExtractObjectKeys(post.Content + " " + post.ImageURL) {
+			referenced[key] = true
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	aboutCursor, err := db.Abouts().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer aboutCursor.Close(ctx)
+
+	var abouts []models.About
+	if err := aboutCursor.All(ctx, &abouts); err != nil {
+		return nil, err
+	}
+	for _, about := range abouts {
+		for _, key := range ExtractObjectKeys(about.Content) {
+			referenced[key] = true
+		}
+	}
+
+	return referenced, nil
+}
+
+// CoverPlaceholders returns the stored placeholders for the given image URLs,
+// keyed by URL. URLs that do not point at a stored object are left out.
+func CoverPlaceholders(ctx context.Context, db *database.MongoDB, urls []string) (map[string]*models.ImagePlaceholder, error) {
+	pathsByURL := map[string]string{}
+	var paths []string
+	for _, url := range urls {
+		objectPaths := ExtractObjectPaths(url)
+		if len(objectPaths) == 0 {
+			continue
+		}
+		objectPath := objectPaths[0]
+		pathsByURL[url] = objectPath
+		paths = append(paths, objectPath)
+	}
+
+	placeholders := map[string]*models.ImagePlaceholder{}
+	if len(paths) == 0 {
+		return placeholders, nil
+	}
+
+	filter := bson.M{
+		"path":     bson.M{"$in": paths},
+		"blurHash": bson.M{"$ne": ""},
+	}
+	cursor, err := db.Media().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []models.Media
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	byPath := map[string]*models.ImagePlaceholder{}
+	for _, item := range items {
+		byPath[item.Path] = &models.ImagePlaceholder{
+			BlurHash:      item.BlurHash,
+			DominantColor: item.DominantColor,
+			Width:         item.Width,
+			Height:        item.Height,
+		}
+	}
+	for url, objectPath := range pathsByURL {
+		if placeholder, ok := byPath[objectPath]; ok {
+			placeholders[url] = placeholder
+		}
+	}
+
+	return placeholders, nil
+}
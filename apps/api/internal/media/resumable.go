@@ -0,0 +1,433 @@
+package media
+
+import (
+	"blog/api/internal/models"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MaxChunkSize = 8 * 1024 * 1024
+	// MinChunkSize applies to every chunk but the last, so the chunk list
+	// stays small: it is stored in the session document and composed by
+	// Storage at most 32 objects at a time
+	MinChunkSize = 256 * 1024
+	// MaxUploadChunks bounds the chunk list; at MinChunkSize it still covers
+	// the largest attachment allowed
+	MaxUploadChunks      = 2048
+	uploadSessionTimeout = 24 * time.Hour
+)
+
+var (
+	ErrSessionNotFound   = errors.New("upload session not found")
+	ErrSessionExpired    = errors.New("upload session has expired")
+	ErrSessionCompleted  = errors.New("upload session is already completed")
+	ErrSessionCompleting = errors.New("upload session is being completed")
+	ErrOffsetMismatch    = errors.New("upload offset does not match the session offset")
+	ErrChunkTooLarge     = errors.New("chunk exceeds the maximum chunk size")
+	ErrChunkTooSmall     = errors.New("chunk is below the minimum chunk size")
+	ErrTooManyChunks     = errors.New("upload exceeds the maximum number of chunks")
+	ErrSizeExceeded      = errors.New("chunk extends past the declared upload size")
+	ErrUploadIncomplete  = errors.New("upload is incomplete")
+	ErrChecksumMismatch  = errors.New("uploaded content does not match the declared checksum")
+	ErrFileTooLarge      = errors.New("file exceeds the size limit for its type")
+	ErrUnsupportedFile   = errors.New("unsupported file type")
+)
+
+// attachmentSizeLimits lists the types accepted by resumable uploads and the
+// largest file allowed for each. Images keep the regular upload limit since
+// they are decoded in memory to compute placeholders.
+var attachmentSizeLimits = map[string]int64{
+	"image/jpeg":      MaxImageSize,
+	"image/jpg":       MaxImageSize,
+	"image/png":       MaxImageSize,
+	"image/gif":       MaxImageSize,
+	"image/webp":      MaxImageSize,
+	"application/pdf": 50 * 1024 * 1024,
+	"video/mp4":       500 * 1024 * 1024,
+	"video/webm":      500 * 1024 * 1024,
+	"audio/mpeg":      100 * 1024 * 1024,
+	"audio/mp4":       100 * 1024 * 1024,
+	"audio/ogg":       100 * 1024 * 1024,
+	"audio/wav":       100 * 1024 * 1024,
+}
+
+// CreateSession starts a resumable upload. Chunks are then appended in order
+// with AppendChunk and the upload is finalized with CompleteSession.
+func (s *Store) CreateSession(ctx context.Context, req models.CreateUploadSessionRequest, uploadedBy string) (*models.UploadSession, error) {
+	limit, ok := attachmentSizeLimits[req.ContentType]
+	if !ok {
+		return nil, ErrUnsupportedFile
+	}
+	if req.Size > limit {
+		return nil, ErrFileTooLarge
+	}
+	visibility, err := s.resolveVisibility(req.Visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	hashState, err := marshalHash(sha256.New())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.UploadSession{
+		ID:          primitive.NewObjectID(),
+		Filename:    req.Filename,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		Checksum:    strings.ToLower(req.Checksum),
+		HashState:   hashState,
+		Chunks:      []string{},
+		AltText:     req.AltText,
+		Caption:     req.Caption,
+		Visibility:  visibility,
+		Status:      models.UploadSessionActive,
+		UploadedBy:  uploadedBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   now.Add(uploadSessionTimeout),
+	}
+
+	if _, err := s.db.UploadSessions().InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSession returns an upload session owned by uploadedBy
+func (s *Store) GetSession(ctx context.Context, id primitive.ObjectID, uploadedBy string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := s.db.UploadSessions().FindOne(ctx, bson.M{"_id": id, "uploadedBy": uploadedBy}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// AppendChunk writes the chunk starting at offset. The offset must equal the
+// number of bytes already received, so a client that lost its connection
+// resumes by asking for the session offset and sending from there.
+func (s *Store) AppendChunk(ctx context.Context, id primitive.ObjectID, uploadedBy string, offset int64, body io.Reader) (*models.UploadSession, error) {
+	session, err := s.activeSession(ctx, id, uploadedBy)
+	if err != nil {
+		return nil, err
+	}
+	if offset != session.Offset {
+		return session, ErrOffsetMismatch
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, MaxChunkSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxChunkSize {
+		return nil, ErrChunkTooLarge
+	}
+	if offset+int64(len(data)) > session.Size {
+		return nil, ErrSizeExceeded
+	}
+	if len(data) == 0 {
+		return session, nil
+	}
+	if len(data) < MinChunkSize && offset+int64(len(data)) != session.Size {
+		return nil, ErrChunkTooSmall
+	}
+	if len(session.Chunks) >= MaxUploadChunks {
+		return nil, ErrTooManyChunks
+	}
+
+	digest, err := unmarshalHash(session.HashState)
+	if err != nil {
+		return nil, err
+	}
+	digest.Write(data)
+	hashState, err := marshalHash(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunk names are unique so a racing request for the same offset cannot
+	// clobber or delete the chunk that wins
+	chunkPath := fmt.Sprintf("uploads/%s/%020d-%s", session.ID.Hex(), offset, uuid.New().String())
+	if err := s.firebase.WriteObject(ctx, chunkPath, bytes.NewReader(data), "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	// Only advance if no concurrent request moved the offset in the meantime
+	newOffset := offset + int64(len(data))
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.UploadSession
+	err = s.db.UploadSessions().FindOneAndUpdate(ctx,
+		bson.M{"_id": session.ID, "offset": offset, "status": models.UploadSessionActive},
+		bson.M{
+			"$set": bson.M{
+				"offset":    newOffset,
+				"hashState": hashState,
+				"updatedAt": time.Now(),
+			},
+			"$push": bson.M{"chunks": chunkPath},
+		},
+		opts,
+	).Decode(&updated)
+	if err != nil {
+		s.firebase.DeleteObject(ctx, chunkPath)
+		if err == mongo.ErrNoDocuments {
+			current, getErr := s.GetSession(ctx, id, uploadedBy)
+			if getErr != nil {
+				return nil, getErr
+			}
+			return current, ErrOffsetMismatch
+		}
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// CompleteSession verifies the checksum of a fully received upload, assembles
+// the chunks into the final object and records it in the media library.
+func (s *Store) CompleteSession(ctx context.Context, id primitive.ObjectID, uploadedBy string) (*models.Media, bool, error) {
+	session, err := s.activeSession(ctx, id, uploadedBy)
+	if err != nil {
+		return nil, false, err
+	}
+	if session.Offset != session.Size {
+		return nil, false, ErrUploadIncomplete
+	}
+
+	digest, err := unmarshalHash(session.HashState)
+	if err != nil {
+		return nil, false, err
+	}
+	checksum := hex.EncodeToString(digest.Sum(nil))
+	if checksum != session.Checksum {
+		return nil, false, ErrChecksumMismatch
+	}
+
+	// Claim the session so a concurrent request cannot assemble it too
+	result, err := s.db.UploadSessions().UpdateOne(ctx,
+		bson.M{"_id": session.ID, "status": models.UploadSessionActive},
+		bson.M{"$set": bson.M{"status": models.UploadSessionCompleting, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, false, ErrSessionCompleting
+	}
+
+	item, deduplicated, err := s.assemble(ctx, session, checksum)
+	if err != nil {
+		// Let the client retry, even if the request timed out
+		s.db.UploadSessions().UpdateOne(context.WithoutCancel(ctx),
+			bson.M{"_id": session.ID, "status": models.UploadSessionCompleting},
+			bson.M{"$set": bson.M{"status": models.UploadSessionActive, "updatedAt": time.Now()}},
+		)
+		return nil, false, err
+	}
+
+	return item, deduplicated, s.finishSession(ctx, session, item.ID)
+}
+
+// assemble turns the chunks of a claimed session into a media entry.
+func (s *Store) assemble(ctx context.Context, session *models.UploadSession, checksum string) (*models.Media, bool, error) {
+	// Images go through the regular pipeline for validation and placeholders
+	if IsAllowedImageType(session.ContentType) {
+		return s.completeImage(ctx, session)
+	}
+
+	existing, err := s.acquireExisting(ctx, checksum, session.Visibility)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, true, nil
+	}
+
+	objectPath := fmt.Sprintf("attachments/%s%s", uuid.New().String(), filepath.Ext(session.Filename))
+	if err := s.firebase.ComposeObjects(ctx, objectPath, session.Chunks, session.ContentType); err != nil {
+		return nil, false, err
+	}
+
+	url := s.fileURL(objectPath)
+	publicURL := ""
+	if session.Visibility == models.MediaPublic {
+		publicURL, err = s.firebase.PublishObject(ctx, objectPath)
+		if err != nil {
+			s.firebase.DeleteObject(ctx, objectPath)
+			return nil, false, err
+		}
+		url = publicURL
+	}
+
+	now := time.Now()
+	item := models.Media{
+		ID:          primitive.NewObjectID(),
+		Path:        objectPath,
+		URL:         url,
+		PublicURL:   publicURL,
+		Visibility:  session.Visibility,
+		Filename:    session.Filename,
+		ContentType: session.ContentType,
+		Size:        session.Size,
+		Hash:        checksum,
+		RefCount:    1,
+		AltText:     session.AltText,
+		Caption:     session.Caption,
+		UploadedBy:  session.UploadedBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	return s.record(ctx, item)
+}
+
+// AbortSession discards an upload session and its received chunks
+func (s *Store) AbortSession(ctx context.Context, id primitive.ObjectID, uploadedBy string) error {
+	session, err := s.GetSession(ctx, id, uploadedBy)
+	if err != nil {
+		return err
+	}
+	if session.Status == models.UploadSessionCompleting {
+		return ErrSessionCompleting
+	}
+	return s.discardSession(ctx, session)
+}
+
+// CleanupExpiredSessions discards sessions that were never completed,
+// including those whose completion was interrupted, and returns how many
+// were removed.
+func (s *Store) CleanupExpiredSessions(ctx context.Context) (int, error) {
+	filter := bson.M{
+		"status":    bson.M{"$in": bson.A{models.UploadSessionActive, models.UploadSessionCompleting}},
+		"expiresAt": bson.M{"$lt": time.Now()},
+	}
+	cursor, err := s.db.UploadSessions().Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.UploadSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return 0, err
+	}
+
+	for i := range sessions {
+		if err := s.discardSession(ctx, &sessions[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+func (s *Store) completeImage(ctx context.Context, session *models.UploadSession) (*models.Media, bool, error) {
+	var data bytes.Buffer
+	for _, chunk := range session.Chunks {
+		chunkData, _, err := s.firebase.ReadObject(ctx, chunk, MaxChunkSize)
+		if err != nil {
+			return nil, false, err
+		}
+		data.Write(chunkData)
+	}
+
+	return s.SaveImage(ctx, ImageUpload{
+		Data:        data.Bytes(),
+		Filename:    session.Filename,
+		ContentType: session.ContentType,
+		AltText:     session.AltText,
+		Caption:     session.Caption,
+		Visibility:  session.Visibility,
+		UploadedBy:  session.UploadedBy,
+	})
+}
+
+func (s *Store) activeSession(ctx context.Context, id primitive.ObjectID, uploadedBy string) (*models.UploadSession, error) {
+	session, err := s.GetSession(ctx, id, uploadedBy)
+	if err != nil {
+		return nil, err
+	}
+	switch session.Status {
+	case models.UploadSessionActive:
+	case models.UploadSessionCompleting:
+		return nil, ErrSessionCompleting
+	default:
+		return nil, ErrSessionCompleted
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
+func (s *Store) finishSession(ctx context.Context, session *models.UploadSession, mediaID primitive.ObjectID) error {
+	s.deleteChunks(ctx, session)
+	_, err := s.db.UploadSessions().UpdateOne(ctx,
+		bson.M{"_id": session.ID},
+		bson.M{
+			"$set": bson.M{
+				"status":    models.UploadSessionCompleted,
+				"mediaId":   mediaID,
+				"chunks":    []string{},
+				"updatedAt": time.Now(),
+			},
+			"$unset": bson.M{"hashState": ""},
+		},
+	)
+	return err
+}
+
+func (s *Store) discardSession(ctx context.Context, session *models.UploadSession) error {
+	s.deleteChunks(ctx, session)
+	_, err := s.db.UploadSessions().DeleteOne(ctx, bson.M{"_id": session.ID})
+	return err
+}
+
+func (s *Store) deleteChunks(ctx context.Context, session *models.UploadSession) {
+	for _, chunk := range session.Chunks {
+		s.firebase.DeleteObject(ctx, chunk)
+	}
+}
+
+// The running SHA-256 state is persisted between chunk requests so the final
+// checksum can be verified without reading the assembled object back.
+func marshalHash(digest hash.Hash) ([]byte, error) {
+	marshaler, ok := digest.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errors.New("hash state cannot be persisted")
+	}
+	return marshaler.MarshalBinary()
+}
+
+func unmarshalHash(state []byte) (hash.Hash, error) {
+	digest := sha256.New()
+	unmarshaler, ok := digest.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, errors.New("hash state cannot be restored")
+	}
+	if err := unmarshaler.UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
@@ -0,0 +1,207 @@
+package media
+
+import (
+	"blog/api/internal/database"
+	"blog/api/internal/firebase"
+	"blog/api/internal/models"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const MaxImageSize = 5 * 1024 * 1024
+
+var (
+	ErrImageTooLarge     = errors.New("image exceeds the maximum size")
+	ErrUnsupportedType   = errors.New("unsupported image type")
+	ErrInvalidImage      = errors.New("image could not be decoded")
+	ErrPrivateDisabled   = errors.New("private media requires MEDIA_URL_SECRET to be configured")
+	ErrInvalidVisibility = errors.New("invalid media visibility")
+	ErrDuplicateMedia    = errors.New("an identical file with this visibility already exists")
+)
+
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/jpg":  true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// IsAllowedImageType reports whether images of the content type are accepted
+func IsAllowedImageType(contentType string) bool {
+	return allowedImageTypes[contentType]
+}
+
+type ImageUpload struct {
+	Data        []byte
+	Filename    string
+	ContentType string
+	AltText     string
+	Caption     string
+	Visibility  string
+	UploadedBy  string
+}
+
+// Store validates images, writes them to storage and records them in the
+// media library, reusing identical objects that are already stored. Remote
+// images are imported through the same path.
+type Store struct {
+	db        *database.MongoDB
+	firebase  *firebase.Firebase
+	fetcher   *Fetcher
+	apiURL    string
+	urlSecret string
+}
+
+func NewStore(db *database.MongoDB, fb *firebase.Firebase, apiURL, urlSecret string) *Store {
+	return &Store{
+		db:        db,
+		firebase:  fb,
+		fetcher:   NewFetcher(),
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		urlSecret: urlSecret,
+	}
+}
+
+// SaveImage stores an image and returns its media record. The returned flag
+// is true when an identical object already existed and was reused.
+func (s *Store) SaveImage(ctx context.Context, upload ImageUpload) (*models.Media, bool, error) {
+	if len(upload.Data) > MaxImageSize {
+		return nil, false, ErrImageTooLarge
+	}
+	if !IsAllowedImageType(upload.ContentType) {
+		return nil, false, ErrUnsupportedType
+	}
+	visibility, err := s.resolveVisibility(upload.Visibility)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Compute dimensions and a loading placeholder, which also rejects files
+	// that are not decodable images
+	placeholder, err := ComputePlaceholder(upload.Data)
+	if errors.Is(err, ErrTooManyPixels) {
+		return nil, false, err
+	}
+	if err != nil {
+		return nil, false, ErrInvalidImage
+	}
+
+	sum := sha256.Sum256(upload.Data)
+	hash := hex.EncodeToString(sum[:])
+
+	// Reuse an identical object if one is already stored
+	existing, err := s.acquireExisting(ctx, hash, visibility)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, true, nil
+	}
+
+	// Upload to Firebase Storage
+	public := visibility == models.MediaPublic
+	uploaded, err := s.firebase.UploadImage(ctx, bytes.NewReader(upload.Data), upload.Filename, upload.ContentType, public)
+	if err != nil {
+		return nil, false, err
+	}
+
+	url := uploaded.URL
+	if !public {
+		url = s.fileURL(uploaded.Path)
+	}
+
+	// Record the upload in the media library
+	now := time.Now()
+	item := models.Media{
+		ID:            primitive.NewObjectID(),
+		Path:          uploaded.Path,
+		URL:           url,
+		PublicURL:     uploaded.URL,
+		Visibility:    visibility,
+		Filename:      upload.Filename,
+		ContentType:   upload.ContentType,
+		Size:          int64(len(upload.Data)),
+		Width:         placeholder.Width,
+		Height:        placeholder.Height,
+		BlurHash:      placeholder.BlurHash,
+		DominantColor: placeholder.DominantColor,
+		Hash:          hash,
+		RefCount:      1,
+		AltText:       upload.AltText,
+		Caption:       upload.Caption,
+		UploadedBy:    upload.UploadedBy,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	return s.record(ctx, item)
+}
+
+// record inserts item. When a concurrent upload of the same content recorded
+// its object first, item's object is discarded and that one is reused.
+func (s *Store) record(ctx context.Context, item models.Media) (*models.Media, bool, error) {
+	_, err := s.db.Media().InsertOne(ctx, item)
+	if err == nil {
+		return &item, false, nil
+	}
+	s.firebase.DeleteObject(ctx, item.Path)
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	existing, acquireErr := s.acquireExisting(ctx, item.Hash, item.Visibility)
+	if acquireErr != nil {
+		return nil, false, acquireErr
+	}
+	if existing == nil {
+		return nil, false, err
+	}
+	return existing, true, nil
+}
+
+// acquireExisting increments the reference count of a stored object with the
+// given content hash and visibility and returns it, or returns nil when none
+// exists. Quarantined objects are skipped since they may be collected at any
+// time.
+func (s *Store) acquireExisting(ctx context.Context, hash, visibility string) (*models.Media, error) {
+	filter := bson.M{
+		"hash":          hash,
+		"quarantinedAt": bson.M{"$exists": false},
+		"visibility":    visibility,
+	}
+	// Records created before visibility existed are public
+	if visibility == models.MediaPublic {
+		filter["visibility"] = bson.M{"$in": bson.A{models.MediaPublic, nil}}
+	}
+
+	// Records created before reference counting count as one reference
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"refCount": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refCount", 1}}, 1}},
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var item models.Media
+	err := s.db.Media().FindOneAndUpdate(ctx, filter, update, opts).Decode(&item)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
@@ -0,0 +1,298 @@
+package media
+
+import (
+	"blog/api/internal/models"
+	"blog/api/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultSignedURLTTL = 15 * time.Minute
+	MaxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+func (s *Store) resolveVisibility(visibility string) (string, error) {
+	switch visibility {
+	case "", models.MediaPublic:
+		return models.MediaPublic, nil
+	case models.MediaPrivate, models.MediaRestricted:
+		if s.urlSecret == "" {
+			return "", ErrPrivateDisabled
+		}
+		return visibility, nil
+	default:
+		return "", ErrInvalidVisibility
+	}
+}
+
+// fileURL is the stable URL for non-public media. It keeps the object path
+// so references to it are found like references to public storage links.
+func (s *Store) fileURL(objectPath string) string {
+	return s.apiURL + "/media/file/" + objectPath
+}
+
+// SignedURL returns a URL granting read access to the media until it expires
+func (s *Store) SignedURL(item *models.Media, ttl time.Duration) (string, time.Time, error) {
+	if s.urlSecret == "" {
+		return "", time.Time{}, ErrPrivateDisabled
+	}
+	if ttl <= 0 {
+		ttl = DefaultSignedURLTTL
+	}
+	ttl = min(ttl, MaxSignedURLTTL)
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", utils.SignPath(item.Path, expiresAt, s.urlSecret))
+
+	return s.fileURL(item.Path) + "?" + query.Encode(), expiresAt, nil
+}
+
+// VerifySignature reports whether a signed URL for the object is valid
+func (s *Store) VerifySignature(objectPath, expires, signature string) bool {
+	return utils.VerifyPathSignature(objectPath, expires, signature, s.urlSecret)
+}
+
+// SetVisibility changes who can read a media object
+func (s *Store) SetVisibility(ctx context.Context, item *models.Media, visibility string) (*models.Media, error) {
+	if _, err := s.resolveVisibility(visibility); err != nil {
+		return nil, err
+	}
+
+	// Only one live entry may hold a given content at each visibility
+	if item.Hash != "" {
+		count, err := s.db.Media().CountDocuments(ctx, bson.M{
+			"hash":          item.Hash,
+			"visibility":    visibility,
+			"quarantinedAt": bson.M{"$exists": false},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrDuplicateMedia
+		}
+	}
+
+	set := bson.M{
+		"visibility": visibility,
+		"updatedAt":  time.Now(),
+	}
+	unset := bson.M{}
+
+	if visibility == models.MediaPublic {
+		publicURL, err := s.firebase.PublishObject(ctx, item.Path)
+		if err != nil {
+			return nil, err
+		}
+		set["publicUrl"] = publicURL
+	} else {
+		if err := s.firebase.UnpublishObject(ctx, item.Path); err != nil {
+			return nil, err
+		}
+		// The public storage link stops working, hand out the stable URL
+		set["url"] = s.fileURL(item.Path)
+		unset["publicUrl"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.Media
+	err := s.db.Media().FindOneAndUpdate(ctx, bson.M{"_id": item.ID}, update, opts).Decode(&updated)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateMedia
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// PublishReferenced makes private media referenced in texts public. It is
+// called when a post is published; restricted media is left untouched. Media
+// whose content is already stored publicly is merged into that entry
+// instead, and posts and about pages are pointed at the public copy; the
+// returned map holds those URL changes, keyed by the old URL. Every item is
+// attempted and the failures are returned together.
+func (s *Store) PublishReferenced(ctx context.Context, texts ...string) (map[string]string, error) {
+	replaced := map[string]string{}
+
+	var paths []string
+	for _, text := range texts {
+		paths = append(paths, ExtractObjectPaths(text)...)
+	}
+	if len(paths) == 0 {
+		return replaced, nil
+	}
+
+	filter := bson.M{
+		"path":       bson.M{"$in": paths},
+		"visibility": models.MediaPrivate,
+	}
+	cursor, err := s.db.Media().Find(ctx, filter)
+	if err != nil {
+		return replaced, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []models.Media
+	if err := cursor.All(ctx, &items); err != nil {
+		return replaced, err
+	}
+
+	var errs []error
+	for i := range items {
+		item := &items[i]
+
+		twin, err := s.publicTwin(ctx, item)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to look up public copy of %s: %w", item.Path, err))
+			continue
+		}
+		if twin == nil {
+			if _, err := s.SetVisibility(ctx, item, models.MediaPublic); err != nil {
+				errs = append(errs, fmt.Errorf("failed to publish %s: %w", item.Path, err))
+			}
+			continue
+		}
+
+		if err := s.mergeInto(ctx, item, twin); err != nil {
+			errs = append(errs, fmt.Errorf("failed to merge %s into %s: %w", item.Path, twin.Path, err))
+			continue
+		}
+		replaced[s.fileURL(item.Path)] = twin.URL
+	}
+	return replaced, errors.Join(errs...)
+}
+
+// publicTwin returns the live public entry holding the same content as item,
+// or nil if there is none.
+func (s *Store) publicTwin(ctx context.Context, item *models.Media) (*models.Media, error) {
+	if item.Hash == "" {
+		return nil, nil
+	}
+
+	var twin models.Media
+	err := s.db.Media().FindOne(ctx, bson.M{
+		"_id":           bson.M{"$ne": item.ID},
+		"hash":          item.Hash,
+		"visibility":    bson.M{"$in": bson.A{models.MediaPublic, nil}},
+		"quarantinedAt": bson.M{"$exists": false},
+	}).Decode(&twin)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &twin, nil
+}
+
+// mergeInto replaces the private item with its public twin: references are
+// pointed at the twin, which takes over the item's reference count, and the
+// item and its object are removed.
+func (s *Store) mergeInto(ctx context.Context, item, twin *models.Media) error {
+	// Relink first so no post points at an entry that is already gone
+	if err := s.replaceReferences(ctx, s.fileURL(item.Path), twin.URL); err != nil {
+		return err
+	}
+
+	// Deleting returns the final reference count, including uploads
+	// deduplicated against the item in the meantime
+	var removed models.Media
+	err := s.db.Media().FindOneAndDelete(ctx, bson.M{"_id": item.ID}).Decode(&removed)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// A concurrent publish merged it already
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Records created before reference counting count as one reference
+	refs := max(removed.RefCount, 1)
+	_, err = s.db.Media().UpdateOne(ctx, bson.M{"_id": twin.ID}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"refCount":  bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refCount", 1}}, refs}},
+			"updatedAt": time.Now(),
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.firebase.DeleteObject(ctx, removed.Path)
+}
+
+// replaceReferences rewrites oldURL to newURL in post content, post cover
+// images and about content.
+func (s *Store) replaceReferences(ctx context.Context, oldURL, newURL string) error {
+	pattern := bson.M{"$regex": regexp.QuoteMeta(oldURL)}
+
+	cursor, err := s.db.Posts().Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"content": pattern},
+			bson.M{"imageUrl": pattern},
+		},
+	}, options.Find().SetProjection(bson.M{"content": 1, "imageUrl": 1}))
+	if err != nil {
+		return err
+	}
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		_, err := s.db.Posts().UpdateOne(ctx, bson.M{"_id": post.ID}, bson.M{"$set": bson.M{
+			"content":  ReplaceURL(post.Content, oldURL, newURL),
+			"imageUrl": ReplaceURL(post.ImageURL, oldURL, newURL),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor, err = s.db.Abouts().Find(ctx, bson.M{"content": pattern})
+	if err != nil {
+		return err
+	}
+	var abouts []models.About
+	if err := cursor.All(ctx, &abouts); err != nil {
+		return err
+	}
+	for _, about := range abouts {
+		_, err := s.db.Abouts().UpdateOne(ctx, bson.M{"_id": about.ID}, bson.M{"$set": bson.M{
+			"content": ReplaceURL(about.Content, oldURL, newURL),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceURL replaces every occurrence of oldURL in text with newURL. A query
+// string following oldURL, such as a signature, is replaced along with it.
+func ReplaceURL(text, oldURL, newURL string) string {
+	if oldURL == "" || !strings.Contains(text, oldURL) {
+		return text
+	}
+	pattern := regexp.MustCompile(regexp.QuoteMeta(oldURL) + `(?:\?[^\s"'<>()\[\]]*)?`)
+	return pattern.ReplaceAllLiteralString(text, newURL)
+}
@@ -0,0 +1,31 @@
+package media
+
+import "testing"
+
+func TestReplaceURL(t *testing.T) {
+	const (
+		privateURL = "https://api.example.com/media/file/images/0f8fad5b-d9cb-469f-a165-70867728950e.png"
+		publicURL  = "https://storage.googleapis.com/bucket/images/7c9e6679-7425-40de-944b-e07fc1f90ae7.png"
+	)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"cover image", privateURL, publicURL},
+		{"markdown image", "Intro\n\n![A cat](" + privateURL + ")\n", "Intro\n\n![A cat](" + publicURL + ")\n"},
+		{"html image", `<img src="` + privateURL + `" alt="">`, `<img src="` + publicURL + `" alt="">`},
+		{"signed url", "![](" + privateURL + "?expires=1700000000&signature=ab12)", "![](" + publicURL + ")"},
+		{"every occurrence", privateURL + " " + privateURL, publicURL + " " + publicURL},
+		{"other media", "![](https://api.example.com/media/file/images/other.png)", "![](https://api.example.com/media/file/images/other.png)"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplaceURL(tt.text, privateURL, publicURL); got != tt.want {
+				t.Errorf("ReplaceURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// FirestoreUnaryInterceptor records the latency of unary Firestore RPCs.
+func FirestoreUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	observeFirestore(method, start, err)
+	return err
+}
+
+// FirestoreStreamInterceptor records the latency of streaming Firestore RPCs
+// such as queries, from opening the stream until it ends. Listen streams stay
+// open for as long as something watches a collection, so they are skipped.
+func FirestoreStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		observeFirestore(method, start, err)
+		return nil, err
+	}
+	if path.Base(method) == "Listen" {
+		return stream, nil
+	}
+	return &observedStream{ClientStream: stream, method: method, start: start}, nil
+}
+
+type observedStream struct {
+	grpc.ClientStream
+	method string
+	start  time.Time
+	once   sync.Once
+}
+
+func (s *observedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.once.Do(func() {
+			if err == io.EOF {
+				observeFirestore(s.method, s.start, nil)
+			} else {
+				observeFirestore(s.method, s.start, err)
+			}
+		})
+	}
+	return err
+}
+
+func observeFirestore(method string, start time.Time, err error) {
+	firestoreDuration.WithLabelValues(path.Base(method), status.Code(err).String()).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "blog_api"
+
+// Status label values for backend operations
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Registry holds every metric the API exposes, along with Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	mongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command latency by command and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "status"})
+
+	firestoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "firestore_call_duration_seconds",
+		Help:      "Firestore RPC latency by method and gRPC status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Cloud Storage operation latency by operation and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	uploadSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of uploaded media, by whether it duplicated an existing upload.",
+		// 16 KiB to 64 MiB
+		Buckets: prometheus.ExponentialBuckets(16<<10, 4, 7),
+	}, []string{"deduplicated"})
+
+	authAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_attempts_total",
+		Help:      "Login, second factor and token refresh attempts by method and result.",
+	}, []string{"method", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		mongoDuration,
+		firestoreDuration,
+		storageDuration,
+		uploadSize,
+		authAttempts,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records a handled HTTP request.
+func ObserveHTTPRequest(method, route, status string, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, status).Inc()
+	httpDuration.WithLabelValues(method, route, status).Observe(duration.Seconds())
+}
+
+// ObserveMongoCommand records a finished MongoDB command. status is
+// StatusOK or StatusError.
+func ObserveMongoCommand(command, status string, duration time.Duration) {
+	mongoDuration.WithLabelValues(command, status).Observe(duration.Seconds())
+}
+
+// ObserveStorage records a Cloud Storage operation that started at start.
+func ObserveStorage(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(operation, statusLabel(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveUpload records the size of an uploaded file.
+func ObserveUpload(size int64, deduplicated bool) {
+	label := "false"
+	if deduplicated {
+		label = "true"
+	}
+	uploadSize.WithLabelValues(label).Observe(float64(size))
+}
+
+// AuthSucceeded counts a successful authentication with method, such as a
+// login provider name, "passkey", "mfa" or "refresh".
+func AuthSucceeded(method string) {
+	authAttempts.WithLabelValues(method, "success").Inc()
+}
+
+// AuthFailed counts a rejected authentication attempt with method.
+func AuthFailed(method string) {
+	authAttempts.WithLabelValues(method, "failure").Inc()
+}
+
+func statusLabel(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
@@ -2,40 +2,140 @@ package middleware
 
 import (
 	"blog/api/internal/config"
+	"blog/api/internal/firebase"
+	"blog/api/internal/models"
+	"blog/api/internal/revocation"
 	"blog/api/pkg/utils"
+	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// accessTokenTouchInterval limits how often the last use of a personal access
+// token is written, so busy scripts do not write on every request.
+const accessTokenTouchInterval = time.Minute
+
+// tokenLookupTimeout bounds the Firestore reads that authenticate a personal
+// access token
+const tokenLookupTimeout = 5 * time.Second
+
+// AuthMiddleware accepts access token JWTs and personal access tokens.
+func AuthMiddleware(cfg *config.Config, revocations *revocation.List, fb *firebase.Firebase) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var tokenString string
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		if authHeader != "" {
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+				c.Abort()
+				return
+			}
+			tokenString = parts[1]
+		} else if cfg.AuthCookies {
+			// Browsers in cookie mode send the access token as a cookie, which
+			// cross-site requests would carry too
+			tokenString, _ = c.Cookie(AccessTokenCookie)
+			if tokenString != "" && !ValidCSRF(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+				c.Abort()
+				return
+			}
+		}
+
+		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			authenticateAccessToken(c, fb, tokenString)
 			return
 		}
 
-		tokenString := parts[1]
-		claims, err := utils.ValidateToken(tokenString, cfg.JWTSecret)
+		// Refresh tokens outlive the revocation entries made on logout, so
+		// only access tokens may be used as bearer tokens
+		claims, err := utils.ValidateAccessToken(tokenString, cfg.JWTKeys)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Reject tokens revoked by logout, session deletion or disabling the
+		// user
+		if revocations.IsRevoked(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Set user info in context
 		c.Set("userId", claims.UserID)
 		c.Set("userEmail", claims.Email)
+		c.Set("userRole", claims.Role)
+		c.Set("sessionId", claims.SessionID)
+		c.Next()
+	}
+}
+
+// authenticateAccessToken authenticates a personal access token. The owner's
+// current role and status are read on every request, so disabling the owner
+// or deleting the token takes effect immediately.
+func authenticateAccessToken(c *gin.Context, fb *firebase.Firebase, tokenString string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), tokenLookupTimeout)
+	defer cancel()
+
+	token, err := fb.FindAccessToken(ctx, utils.HashOpaqueToken(tokenString))
+	if err != nil || token.IsExpired(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	userData, err := fb.GetUser(ctx, token.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+	if status, _ := userData["status"].(string); status == models.UserDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been disabled"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval {
+		if err := fb.TouchAccessToken(ctx, token.ID, now); err != nil {
+			GetLogger(c).Warn("Failed to record use of access token", "tokenId", token.ID, "error", err)
+		}
+	}
+
+	email, _ := userData["email"].(string)
+	role, _ := userData["role"].(string)
+
+	c.Set("userId", token.UserID)
+	c.Set("userEmail", email)
+	c.Set("userRole", role)
+	c.Set("accessTokenId", token.ID)
+	c.Set("tokenScopes", token.Scopes)
+	c.Next()
+}
+
+// RequireSession rejects personal access tokens, for endpoints that manage
+// the account itself. It must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetTokenScopes(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens cannot be used for this endpoint"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -57,3 +157,32 @@ func GetUserEmail(c *gin.Context) (string, bool) {
 	emailStr, ok := email.(string)
 	return emailStr, ok
 }
+
+func GetUserRole(c *gin.Context) (string, bool) {
+	role, exists := c.Get("userRole")
+	if !exists {
+		return "", false
+	}
+	roleStr, ok := role.(string)
+	return roleStr, ok
+}
+
+func GetSessionID(c *gin.Context) (string, bool) {
+	sessionID, exists := c.Get("sessionId")
+	if !exists {
+		return "", false
+	}
+	sessionIDStr, ok := sessionID.(string)
+	return sessionIDStr, ok && sessionIDStr != ""
+}
+
+// GetTokenScopes returns the scopes of the personal access token the request
+// was authenticated with. It returns false for JWT-authenticated requests.
+func GetTokenScopes(c *gin.Context) ([]string, bool) {
+	scopes, exists := c.Get("tokenScopes")
+	if !exists {
+		return nil, false
+	}
+	scopesSlice, ok := scopes.([]string)
+	return scopesSlice, ok
+}
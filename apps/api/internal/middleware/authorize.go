@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"blog/api/internal/rbac"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission rejects requests whose role does not grant permission.
+// It must run after AuthMiddleware.
+func RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Can(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Can reports whether the authenticated user's role grants permission. Personal
+// access tokens are further limited to their scopes, except for reads which
+// every scope allows.
+func Can(c *gin.Context, permission rbac.Permission) bool {
+	role, _ := GetUserRole(c)
+	if !rbac.Can(role, permission) {
+		return false
+	}
+
+	scopes, ok := GetTokenScopes(c)
+	if !ok || isReadOnlyMethod(c.Request.Method) {
+		return true
+	}
+	return rbac.ScopesGrant(scopes, permission)
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
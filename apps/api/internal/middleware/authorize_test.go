@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"blog/api/internal/models"
+	"blog/api/internal/rbac"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		scopes     []string // nil for a session, not a personal access token
+		method     string
+		permission rbac.Permission
+		want       bool
+	}{
+		{"session with role", models.RoleAuthor, nil, http.MethodPost, rbac.PublishPosts, true},
+		{"session without role", models.RoleContributor, nil, http.MethodPost, rbac.PublishPosts, false},
+		{"token with role and scope", models.RoleAuthor, []string{"posts:write"}, http.MethodPost, rbac.PublishPosts, true},
+		{"token with role but not scope", models.RoleAuthor, []string{"uploads:write"}, http.MethodPost, rbac.PublishPosts, false},
+		{"token with scope but not role", models.RoleContributor, []string{"posts:write"}, http.MethodPost, rbac.PublishPosts, false},
+		{"read-only token reads", models.RoleOwner, []string{"read"}, http.MethodGet, rbac.ViewAuditLog, true},
+		{"read-only token writes", models.RoleOwner, []string{"read"}, http.MethodDelete, rbac.DeleteAnyPost, false},
+		{"token without scopes writes", models.RoleOwner, []string{}, http.MethodPut, rbac.EditAbout, false},
+		{"reads still need the role", models.RoleEditor, []string{"read"}, http.MethodGet, rbac.ViewAuditLog, false},
+		{"no scope grants user management", models.RoleOwner, []string{"posts:write", "uploads:write"}, http.MethodPost, rbac.ManageUsers, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(tt.method, "/", nil)
+			c.Set("userRole", tt.role)
+			if tt.scopes != nil {
+				c.Set("tokenScopes", tt.scopes)
+			}
+
+			if got := Can(c, tt.permission); got != tt.want {
+				t.Errorf("Can() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"blog/api/internal/config"
+	"blog/api/pkg/utils"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookie names used when cfg.AuthCookies is enabled. The token cookies are
+// HttpOnly so scripts cannot read them; the CSRF cookie is not, so the web
+// app can echo it in CSRFHeader.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// The refresh token is only sent to the endpoints that use it.
+const refreshTokenCookiePath = "/auth"
+
+// SetAuthCookies stores a token pair in cookies and starts a new CSRF token,
+// which is returned for the response body.
+func SetAuthCookies(c *gin.Context, cfg *config.Config, accessToken, refreshToken string) (string, error) {
+	csrfToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(c, cfg, AccessTokenCookie, accessToken, "/", int(utils.AccessTokenTTL.Seconds()), true)
+	setCookie(c, cfg, RefreshTokenCookie, refreshToken, refreshTokenCookiePath, int(utils.RefreshTokenTTL.Seconds()), true)
+	setCookie(c, cfg, CSRFCookie, csrfToken, "/", int(utils.RefreshTokenTTL.Seconds()), false)
+	return csrfToken, nil
+}
+
+// ClearAuthCookies removes the cookies set by SetAuthCookies.
+func ClearAuthCookies(c *gin.Context, cfg *config.Config) {
+	setCookie(c, cfg, AccessTokenCookie, "", "/", -1, true)
+	setCookie(c, cfg, RefreshTokenCookie, "", refreshTokenCookiePath, -1, true)
+	setCookie(c, cfg, CSRFCookie, "", "/", -1, false)
+}
+
+func setCookie(c *gin.Context, cfg *config.Config, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   cfg.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cfg.CookieSameSite,
+	})
+}
+
+// ValidCSRF implements the double-submit pattern for cookie-authenticated
+// requests: state-changing requests must repeat the CSRF cookie in CSRFHeader.
+// Another site can make the browser send our cookies, but cannot read them to
+// set the header.
+func ValidCSRF(c *gin.Context) bool {
+	if isReadOnlyMethod(c.Request.Method) {
+		return true
+	}
+
+	expected, err := c.Cookie(CSRFCookie)
+	if err != nil || expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(c.GetHeader(CSRFHeader))) == 1
+}
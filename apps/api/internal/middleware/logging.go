@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"blog/api/internal/logging"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID from the client or a proxy in front
+// of the API, and back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID keeps client-supplied IDs short and free of characters that
+// could forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID assigns every request an ID, reusing a valid X-Request-ID from
+// the client, and a logger that tags every line with it and, when the request
+// is traced, with its trace ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		logger := slog.Default().With("requestId", requestID)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			logger = logger.With("traceId", span.TraceID().String())
+		}
+		c.Set("requestId", requestID)
+		c.Set("logger", logger)
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// RequestLogger logs every request once it has been handled. Server errors
+// are logged at error level and client errors at warn level.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latencyMs", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("ip", c.ClientIP()),
+			slog.String("userAgent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		GetLogger(c).LogAttrs(c.Request.Context(), level, "Request handled", attrs...)
+	}
+}
+
+// Recovery turns panics into 500 responses and logs them with their stack.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		GetLogger(c).Error("Panic while handling request", "panic", err, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	})
+}
+
+func GetRequestID(c *gin.Context) (string, bool) {
+	requestID, exists := c.Get("requestId")
+	if !exists {
+		return "", false
+	}
+	requestIDStr, ok := requestID.(string)
+	return requestIDStr, ok
+}
+
+// GetLogger returns the request's logger, tagged with the authenticated user
+// once there is one. It falls back to the default logger outside RequestID.
+func GetLogger(c *gin.Context) *slog.Logger {
+	value, _ := c.Get("logger")
+	logger, ok := value.(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	if userID, ok := GetUserID(c); ok {
+		logger = logger.With("userId", userID)
+	}
+	return logger
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"blog/api/internal/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit limits how often each client may call the routes of group.
+// Authenticated clients are limited by user ID, anonymous ones by IP, so it
+// must run after AuthMiddleware on authenticated routes. If the store fails
+// the request is let through rather than taking the routes down with it.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	if !limit.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(ceilSeconds(limit.Period))
+
+	return func(c *gin.Context) {
+		key := group + ":ip:" + c.ClientIP()
+		if userID, ok := GetUserID(c); ok {
+			key = group + ":user:" + userID
+		}
+
+		result, err := store.Take(c.Request.Context(), key, limit)
+		if err != nil {
+			GetLogger(c).Error("Rate limit store failed", "key", key, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, as the headers require.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
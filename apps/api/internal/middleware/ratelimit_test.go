@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"blog/api/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitedRouter(limit ratelimit.Limit) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetTrustedProxies(nil)
+	router.GET("/", RateLimit(ratelimit.NewMemoryStore(), "test", limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func serve(router *gin.Engine, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.Limit{Requests: 2, Period: time.Minute})
+
+	tests := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{http.StatusOK, "1", "30", ""},
+		{http.StatusOK, "0", "60", ""},
+		{http.StatusTooManyRequests, "0", "60", "30"},
+	}
+	for i, tt := range tests {
+		w := serve(router, "192.0.2.1:1234", nil)
+		if w.Code != tt.status {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, tt.status)
+		}
+		want := map[string]string{
+			"RateLimit-Policy":    "2;w=60",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"Retry-After":         tt.retryAfter,
+		}
+		for name, value := range want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("request %d: %s = %q, want %q", i+1, name, got, value)
+			}
+		}
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.Limit{Requests: 1, Period: time.Hour})
+
+	if w := serve(router, "192.0.2.1:1234", nil); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       int
+	}{
+		{"same IP", "192.0.2.1:5678", nil, http.StatusTooManyRequests},
+		{"forwarded IP from an untrusted peer", "192.0.2.1:5678", http.Header{"X-Forwarded-For": {"198.51.100.7"}}, http.StatusTooManyRequests},
+		{"other IP", "192.0.2.2:1234", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(router, tt.remoteAddr, tt.header); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.Limit{})
+
+	for i := 0; i < 3; i++ {
+		w := serve(router, "192.0.2.1:1234", nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want none", i+1, got)
+		}
+	}
+}
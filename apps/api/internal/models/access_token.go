@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can
+// be told apart from JWTs and recognised by secret scanners.
+const PersonalAccessTokenPrefix = "bpat_"
+
+// PersonalAccessToken is a long-lived credential for scripts and CI. Only a
+// hash of the token is stored; it acts as its owner, limited to its scopes.
+type PersonalAccessToken struct {
+	ID        string   `firestore:"-" json:"id"`
+	UserID    string   `firestore:"userId" json:"-"`
+	Name      string   `firestore:"name" json:"name"`
+	Scopes    []string `firestore:"scopes" json:"scopes"`
+	TokenHash string   `firestore:"tokenHash" json:"-"`
+	// Hint is the start of the token, to tell tokens apart in listings
+	Hint       string     `firestore:"hint" json:"hint"`
+	CreatedAt  time.Time  `firestore:"createdAt" json:"createdAt"`
+	LastUsedAt *time.Time `firestore:"lastUsedAt" json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `firestore:"expiresAt" json:"expiresAt,omitempty"`
+}
+
+// IsExpired reports whether the token has passed its expiry, if it has one.
+func (t *PersonalAccessToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=read posts:write uploads:write"`
+	// ExpiresInDays is optional; tokens without it never expire
+	ExpiresInDays int `json:"expiresInDays" binding:"min=0,max=366"`
+}
+
+// CreatePersonalAccessTokenResponse is the only time the token is shown.
+type CreatePersonalAccessTokenResponse struct {
+	Token string `json:"token"`
+	PersonalAccessToken
+}
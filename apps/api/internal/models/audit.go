@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions
+const (
+	AuditPostCreate        = "post.create"
+	AuditPostUpdate        = "post.update"
+	AuditPostDelete        = "post.delete"
+	AuditAboutUpdate       = "about.update"
+	AuditMediaUpload       = "media.upload"
+	AuditMediaUpdate       = "media.update"
+	AuditMediaDelete       = "media.delete"
+	AuditMediaGC           = "media.gc"
+	AuditLogin             = "auth.login"
+	AuditLogout            = "auth.logout"
+	AuditLogoutAll         = "auth.logout_all"
+	AuditTokenRefresh      = "auth.refresh"
+	AuditTOTPDisable       = "auth.totp_disable"
+	AuditPasskeyDelete     = "auth.passkey_delete"
+	AuditAccessTokenCreate = "access_token.create"
+	AuditAccessTokenDelete = "access_token.delete"
+	AuditUserInvite        = "user.invite"
+	AuditUserRoleUpdate    = "user.role_update"
+	AuditUserDisable       = "user.disable"
+	AuditUserEnable        = "user.enable"
+	AuditInvitationCreate  = "invitation.create"
+	AuditInvitationDelete  = "invitation.delete"
+)
+
+// Audit target types
+const (
+	AuditTargetPost        = "post"
+	AuditTargetAbout       = "about"
+	AuditTargetMedia       = "media"
+	AuditTargetSession     = "session"
+	AuditTargetUser        = "user"
+	AuditTargetInvitation  = "invitation"
+	AuditTargetAccessToken = "access_token"
+	AuditTargetPasskey     = "passkey"
+)
+
+// AuditEntry records who did what to which object, from where.
+type AuditEntry struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Action     string             `json:"action" bson:"action"`
+	ActorID    string             `json:"actorId" bson:"actorId"`
+	ActorEmail string             `json:"actorEmail" bson:"actorEmail"`
+	IP         string             `json:"ip" bson:"ip"`
+	UserAgent  string             `json:"userAgent" bson:"userAgent"`
+	TargetType string             `json:"targetType,omitempty" bson:"targetType,omitempty"`
+	TargetID   string             `json:"targetId,omitempty" bson:"targetId,omitempty"`
+	Changes    []FieldChange      `json:"changes,omitempty" bson:"changes,omitempty"`
+	// Details holds action-specific context, such as the login method
+	Details   map[string]string `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt time.Time         `json:"createdAt" bson:"createdAt"`
+}
+
+// FieldChange is one changed field. Long values are truncated.
+type FieldChange struct {
+	Field string      `json:"field" bson:"field"`
+	Old   interface{} `json:"old,omitempty" bson:"old,omitempty"`
+	New   interface{} `json:"new,omitempty" bson:"new,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+	Total   int64        `json:"total"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Invitation lets the owner of Email create an account with Role by logging
+// in with the invite token. Only a hash of the token is stored.
+type Invitation struct {
+	ID         string     `firestore:"-" json:"id"`
+	Email      string     `firestore:"email" json:"email"`
+	Role       string     `firestore:"role" json:"role"`
+	InvitedBy  string     `firestore:"invitedBy" json:"invitedBy"`
+	CreatedAt  time.Time  `firestore:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time  `firestore:"expiresAt" json:"expiresAt"`
+	AcceptedAt *time.Time `firestore:"acceptedAt" json:"acceptedAt,omitempty"`
+	AcceptedBy string     `firestore:"acceptedBy" json:"acceptedBy,omitempty"`
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner editor author contributor"`
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// MediaPublic objects are world-readable
+	MediaPublic = "public"
+	// MediaPrivate objects are served through signed URLs until a published
+	// post references them, at which point they are made public
+	MediaPrivate = "private"
+	// MediaRestricted objects are only ever served through signed URLs
+	MediaRestricted = "restricted"
+)
+
+type Media struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Path          string             `json:"path" bson:"path"`
+	URL           string             `json:"url" bson:"url"`
+	PublicURL     string             `json:"publicUrl,omitempty" bson:"publicUrl,omitempty"`
+	Visibility    string             `json:"visibility" bson:"visibility"`
+	Filename      string             `json:"filename" bson:"filename"`
+	ContentType   string             `json:"contentType" bson:"contentType"`
+	Size          int64              `json:"size" bson:"size"`
+	Width         int                `json:"width" bson:"width"`
+	Height        int                `json:"height" bson:"height"`
+	BlurHash      string             `json:"blurHash" bson:"blurHash"`
+	DominantColor string             `json:"dominantColor" bson:"dominantColor"`
+	Hash          string             `json:"hash" bson:"hash"`
+	RefCount      int                `json:"refCount" bson:"refCount"`
+	AltText       string             `json:"altText" bson:"altText"`
+	Caption       string             `json:"caption" bson:"caption"`
+	UploadedBy    string             `json:"uploadedBy" bson:"uploadedBy"`
+	QuarantinedAt *time.Time         `json:"quarantinedAt,omitempty" bson:"quarantinedAt,omitempty"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+type UpdateMediaRequest struct {
+	AltText    *string `json:"altText"`
+	Caption    *string `json:"caption"`
+	Visibility *string `json:"visibility" binding:"omitempty,oneof=public private restricted"`
+}
+
+type SignedURLRequest struct {
+	// TTL is the lifetime of the URL in seconds
+	TTL int `json:"ttl"`
+}
+
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type MediaReference struct {
+	PostID primitive.ObjectID `json:"postId"`
+	Title  string             `json:"title"`
+}
+
+type MediaListResponse struct {
+	Media   []Media `json:"media"`
+	Page    int     `json:"page"`
+	Limit   int     `json:"limit"`
+	Total   int64   `json:"total"`
+	HasMore bool    `json:"hasMore"`
+}
+
+type MediaDetailResponse struct {
+	Media      Media            `json:"media"`
+	References []MediaReference `json:"references"`
+}
+
+type UploadFromURLRequest struct {
+	URL        string `json:"url" binding:"required"`
+	AltText    string `json:"altText"`
+	Caption    string `json:"caption"`
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public private restricted"`
+}
+
+type UploadResponse struct {
+	URL          string `json:"url"`
+	SignedURL    string `json:"signedUrl,omitempty"`
+	Media        Media  `json:"media"`
+	Deduplicated bool   `json:"deduplicated"`
+}
+
+type GCObject struct {
+	Path          string     `json:"path"`
+	Size          int64      `json:"size"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	QuarantinedAt *time.Time `json:"quarantinedAt,omitempty"`
+}
+
+type GCReport struct {
+	DryRun          bool       `json:"dryRun"`
+	StartedAt       time.Time  `json:"startedAt"`
+	FinishedAt      time.Time  `json:"finishedAt"`
+	Scanned         int        `json:"scanned"`
+	Referenced      int        `json:"referenced"`
+	TooRecent       int        `json:"tooRecent"`
+	Quarantined     []GCObject `json:"quarantined"`
+	Pending         []GCObject `json:"pending"`
+	Restored        []GCObject `json:"restored"`
+	Deleted         []GCObject `json:"deleted"`
+	FreedBytes      int64      `json:"freedBytes"`
+	ExpiredSessions int        `json:"expiredSessions"`
+}
+
+type ImagePlaceholder struct {
+	BlurHash      string `json:"blurHash" bson:"blurHash"`
+	DominantColor string `json:"dominantColor" bson:"dominantColor"`
+	Width         int    `json:"width" bson:"width"`
+	Height        int    `json:"height" bson:"height"`
+}
+
+type PlaceholderBackfillFailure struct {
+	PostID primitive.ObjectID `json:"postId"`
+	Error  string             `json:"error"`
+}
+
+type PlaceholderBackfillReport struct {
+	Processed int                          `json:"processed"`
+	Updated   int                          `json:"updated"`
+	Skipped   int                          `json:"skipped"`
+	Failed    []PlaceholderBackfillFailure `json:"failed"`
+}
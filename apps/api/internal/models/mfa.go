@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+const (
+	// MFAMethodTOTP is a code from an authenticator app
+	MFAMethodTOTP = "totp"
+	// MFAMethodRecoveryCode is one of the single-use recovery codes
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+// TOTP is a user's authenticator app enrollment. It is created disabled and
+// only takes effect once the user has confirmed a code from the app.
+type TOTP struct {
+	Secret  string `firestore:"secret" json:"-"`
+	Enabled bool   `firestore:"enabled" json:"enabled"`
+	// RecoveryCodes holds hashes of the unused recovery codes
+	RecoveryCodes []string `firestore:"recoveryCodes" json:"-"`
+	// LastStep is the time step of the last accepted code; older codes are
+	// refused so a code cannot be used twice
+	LastStep       int64      `firestore:"lastStep" json:"-"`
+	FailedAttempts int        `firestore:"failedAttempts" json:"-"`
+	LockedUntil    time.Time  `firestore:"lockedUntil" json:"-"`
+	CreatedAt      time.Time  `firestore:"createdAt" json:"createdAt"`
+	EnabledAt      *time.Time `firestore:"enabledAt" json:"enabledAt,omitempty"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	// Code is a code from the authenticator app or a recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAStatusResponse struct {
+	TOTPEnabled            bool `json:"totpEnabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`
+	// ProvisioningURI is the otpauth:// URI to show as a QR code
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the user
+// has a second factor enabled.
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfaRequired"`
+	MFAToken    string   `json:"mfaToken"`
+	Methods     []string `json:"methods"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	// CeremonyRegistration is a passkey being added to a signed-in user
+	CeremonyRegistration = "registration"
+	// CeremonyLogin is a login with a passkey
+	CeremonyLogin = "login"
+)
+
+// Passkey is a WebAuthn credential registered by a user. Passkeys are stored
+// under the user's document, keyed by the base64url credential ID.
+type Passkey struct {
+	ID         string              `firestore:"-" json:"id"`
+	Name       string              `firestore:"name" json:"name"`
+	Credential webauthn.Credential `firestore:"credential" json:"-"`
+	CreatedAt  time.Time           `firestore:"createdAt" json:"createdAt"`
+	LastUsedAt *time.Time          `firestore:"lastUsedAt" json:"lastUsedAt,omitempty"`
+}
+
+// WebAuthnCeremony holds the challenge of a registration or login between its
+// begin and finish requests. Each ceremony can be finished once.
+type WebAuthnCeremony struct {
+	ID        string    `firestore:"-" json:"id"`
+	Kind      string    `firestore:"kind" json:"kind"`
+	UserID    string    `firestore:"userId" json:"userId,omitempty"`
+	Session   []byte    `firestore:"session" json:"-"`
+	ExpiresAt time.Time `firestore:"expiresAt" json:"expiresAt"`
+}
+
+type WebAuthnBeginResponse struct {
+	CeremonyID string      `json:"ceremonyId"`
+	Options    interface{} `json:"options"`
+}
+
+type WebAuthnRegisterRequest struct {
+	CeremonyID string `json:"ceremonyId" binding:"required"`
+	// Name labels the passkey in the credential list, e.g. "YubiKey"
+	Name       string          `json:"name" binding:"max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnLoginRequest struct {
+	CeremonyID string          `json:"ceremonyId" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
@@ -12,6 +12,7 @@ type Post struct {
 	Content   string             `json:"content" bson:"content" binding:"required"`
 	Summary   string             `json:"summary" bson:"summary" binding:"required"`
 	ImageURL  string             `json:"imageUrl" bson:"imageUrl"`
+	Cover     *ImagePlaceholder  `json:"cover,omitempty" bson:"-"`
 	Published bool               `json:"published" bson:"published"`
 	AuthorID  string             `json:"authorId" bson:"authorId" binding:"required"`
 	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
@@ -19,19 +20,21 @@ type Post struct {
 }
 
 type CreatePostRequest struct {
-	Title     string `json:"title" binding:"required"`
-	Content   string `json:"content" binding:"required"`
-	Summary   string `json:"summary" binding:"required"`
-	ImageURL  string `json:"imageUrl"`
-	Published *bool  `json:"published"`
+	Title          string `json:"title" binding:"required"`
+	Content        string `json:"content" binding:"required"`
+	Summary        string `json:"summary" binding:"required"`
+	ImageURL       string `json:"imageUrl"`
+	Published      *bool  `json:"published"`
+	LocalizeImages bool   `json:"localizeImages"`
 }
 
 type UpdatePostRequest struct {
-	Title     *string `json:"title"`
-	Content   *string `json:"content"`
-	Summary   *string `json:"summary"`
-	ImageURL  *string `json:"imageUrl"`
-	Published *bool   `json:"published"`
+	Title          *string `json:"title"`
+	Content        *string `json:"content"`
+	Summary        *string `json:"summary"`
+	ImageURL       *string `json:"imageUrl"`
+	Published      *bool   `json:"published"`
+	LocalizeImages bool    `json:"localizeImages"`
 }
 
 type PostsResponse struct {
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	// RevokedToken revokes a single access token by its jti
+	RevokedToken = "token"
+	// RevokedSession revokes every access token issued for a session
+	RevokedSession = "session"
+	// RevokedUser revokes every access token issued to a user up to RevokedAt
+	RevokedUser = "user"
+)
+
+// Revocation is an entry of the access token revocation list. Entries are only
+// needed until every token they cover has expired.
+type Revocation struct {
+	Kind      string    `firestore:"kind" json:"kind"`
+	Subject   string    `firestore:"subject" json:"subject"`
+	RevokedAt time.Time `firestore:"revokedAt" json:"revokedAt"`
+	ExpiresAt time.Time `firestore:"expiresAt" json:"expiresAt"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	UploadSessionActive = "active"
+	// UploadSessionCompleting sessions are being assembled by a complete
+	// request and accept no more chunks
+	UploadSessionCompleting = "completing"
+	UploadSessionCompleted  = "completed"
+)
+
+type UploadSession struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Filename    string              `json:"filename" bson:"filename"`
+	ContentType string              `json:"contentType" bson:"contentType"`
+	Size        int64               `json:"size" bson:"size"`
+	Offset      int64               `json:"offset" bson:"offset"`
+	Checksum    string              `json:"checksum" bson:"checksum"`
+	HashState   []byte              `json:"-" bson:"hashState"`
+	Chunks      []string            `json:"-" bson:"chunks"`
+	AltText     string              `json:"altText" bson:"altText"`
+	Caption     string              `json:"caption" bson:"caption"`
+	Visibility  string              `json:"visibility" bson:"visibility"`
+	Status      string              `json:"status" bson:"status"`
+	MediaID     *primitive.ObjectID `json:"mediaId,omitempty" bson:"mediaId,omitempty"`
+	UploadedBy  string              `json:"uploadedBy" bson:"uploadedBy"`
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt" bson:"updatedAt"`
+	ExpiresAt   time.Time           `json:"expiresAt" bson:"expiresAt"`
+}
+
+type CreateUploadSessionRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"contentType" binding:"required"`
+	Size        int64  `json:"size" binding:"required,gt=0"`
+	Checksum    string `json:"checksum" binding:"required,len=64,hexadecimal"`
+	AltText     string `json:"altText"`
+	Caption     string `json:"caption"`
+	Visibility  string `json:"visibility" binding:"omitempty,oneof=public private restricted"`
+}
@@ -2,37 +2,109 @@ package models
 
 import "time"
 
+const (
+	// RoleOwner can do everything, including managing users
+	RoleOwner = "owner"
+	// RoleEditor can publish and edit every post, the about page and media
+	RoleEditor = "editor"
+	// RoleAuthor can write and publish their own posts
+	RoleAuthor = "author"
+	// RoleContributor can write drafts but not publish them
+	RoleContributor = "contributor"
+)
+
+const (
+	// UserActive users can log in. Users created before statuses existed have
+	// an empty status and are active too.
+	UserActive = "active"
+	// UserInvited entries allow an email to log in; the entry is replaced by
+	// the real user on first login
+	UserInvited = "invited"
+	// UserDisabled users cannot log in and their tokens are revoked
+	UserDisabled = "disabled"
+)
+
 type User struct {
 	ID          string    `firestore:"id" json:"id"`
 	Email       string    `firestore:"email" json:"email"`
 	Name        string    `firestore:"name" json:"name"`
 	Picture     string    `firestore:"picture" json:"picture"`
+	Role        string    `firestore:"role" json:"role"`
+	Status      string    `firestore:"status" json:"status"`
 	CreatedAt   time.Time `firestore:"createdAt" json:"createdAt"`
 	LastLoginAt time.Time `firestore:"lastLoginAt" json:"lastLoginAt"`
+	// WebAuthnID is the random user handle passkeys are registered with
+	WebAuthnID []byte `firestore:"webauthnId,omitempty" json:"-"`
+}
+
+// Session is a login on one device. The refresh token issued for it is
+// rotated on every use; only TokenID is accepted for the next refresh.
+type Session struct {
+	ID      string `firestore:"-" json:"id"`
+	UserID  string `firestore:"userId" json:"-"`
+	TokenID string `firestore:"tokenId" json:"-"`
+	// PreviousTokenID is the token TokenID replaced at RotatedAt, still
+	// accepted for a short while so concurrent refreshes do not count as
+	// reuse
+	PreviousTokenID string    `firestore:"previousTokenId,omitempty" json:"-"`
+	RotatedAt       time.Time `firestore:"rotatedAt" json:"-"`
+	UserAgent       string    `firestore:"userAgent" json:"userAgent"`
+	IP              string    `firestore:"ip" json:"ip"`
+	CreatedAt       time.Time `firestore:"createdAt" json:"createdAt"`
+	LastUsedAt      time.Time `firestore:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt       time.Time `firestore:"expiresAt" json:"expiresAt"`
+	Current         bool      `firestore:"-" json:"current"`
+}
+
+// IsActive reports whether the user may log in.
+func (u *User) IsActive() bool {
+	return u.Status == "" || u.Status == UserActive
 }
 
-type RefreshToken struct {
-	Token     string    `firestore:"token" json:"token"`
-	UserID    string    `firestore:"userId" json:"userId"`
-	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+type InviteUserRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=owner editor author contributor"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor author contributor"`
 }
 
 type GoogleLoginRequest struct {
 	Token string `json:"token" binding:"required"`
+	// InviteToken lets an invited email create an account on first login
+	InviteToken string `json:"inviteToken"`
+}
+
+// LoginRequest carries either an ID token from the provider, or an
+// authorization code for the API to exchange.
+type LoginRequest struct {
+	Token        string `json:"token"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirectUri"`
+	CodeVerifier string `json:"codeVerifier"`
+	InviteToken  string `json:"inviteToken"`
 }
 
+// RefreshTokenRequest may be empty in cookie mode, where the refresh token
+// comes from its cookie.
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refreshToken" binding:"required"`
+	RefreshToken string `json:"refreshToken"`
 }
 
+// AuthResponse carries the tokens in the body, or only the CSRF token when
+// they are set as cookies.
 type AuthResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken  string `json:"accessToken,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	CSRFToken    string `json:"csrfToken,omitempty"`
 	User         User   `json:"user"`
 }
 
 type TokenResponse struct {
-	AccessToken string `json:"accessToken"`
+	AccessToken  string `json:"accessToken,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	CSRFToken    string `json:"csrfToken,omitempty"`
 }
 
 type MessageResponse struct {
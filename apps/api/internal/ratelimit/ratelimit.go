@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Period. Buckets hold up to Requests
+// tokens and refill evenly over Period, so short bursts are allowed as long
+// as the average stays within the limit. The zero Limit disables limiting.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// rate returns how many tokens are added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// ParseLimit reads a limit written as "<requests>/<period>", such as "10/1m".
+// "off" and "0" disable limiting.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must look like 10/1m", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid request count", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid period", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Result describes a bucket after a request was counted against it.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole requests left in the bucket
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, when this one
+	// was not
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. MemoryStore suits a single instance; deploys
+// with several replicas should share buckets through a Store backed by a
+// shared database so a client cannot multiply its limit by the replica count.
+type Store interface {
+	// Take refills the bucket for key according to limit and removes one
+	// token from it if there is one.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take applies the token bucket algorithm to a bucket last updated at
+// updated that held tokens tokens. It returns the bucket's new token count
+// along with the result.
+func take(tokens float64, updated, now time.Time, limit Limit) (float64, Result) {
+	rate := limit.rate()
+	burst := float64(limit.Requests)
+
+	tokens += now.Sub(updated).Seconds() * rate
+	if tokens > burst {
+		tokens = burst
+	}
+
+	result := Result{}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int(tokens)
+	result.Reset = seconds((burst - tokens) / rate)
+
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
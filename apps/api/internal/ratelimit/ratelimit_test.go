@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	// 10 requests per minute refill one token every 6 seconds
+	limit := Limit{Requests: 10, Period: time.Minute}
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		want       Result
+	}{
+		{
+			name:       "full bucket",
+			tokens:     10,
+			wantTokens: 9,
+			want:       Result{Allowed: true, Remaining: 9, Reset: 6 * time.Second},
+		},
+		{
+			name:       "refill is capped at the burst",
+			tokens:     10,
+			elapsed:    time.Hour,
+			wantTokens: 9,
+			want:       Result{Allowed: true, Remaining: 9, Reset: 6 * time.Second},
+		},
+		{
+			name:       "last token",
+			tokens:     1,
+			wantTokens: 0,
+			want:       Result{Allowed: true, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:       "empty bucket",
+			tokens:     0,
+			wantTokens: 0,
+			want:       Result{Allowed: false, Remaining: 0, Reset: time.Minute, RetryAfter: 6 * time.Second},
+		},
+		{
+			name:       "partly refilled",
+			tokens:     0,
+			elapsed:    3 * time.Second,
+			wantTokens: 0.5,
+			want:       Result{Allowed: false, Remaining: 0, Reset: 57 * time.Second, RetryAfter: 3 * time.Second},
+		},
+		{
+			name:       "refilled one token",
+			tokens:     0,
+			elapsed:    6 * time.Second,
+			wantTokens: 0,
+			want:       Result{Allowed: true, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:       "refilled evenly over the period",
+			tokens:     0,
+			elapsed:    30 * time.Second,
+			wantTokens: 4,
+			want:       Result{Allowed: true, Remaining: 4, Reset: 36 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, got := take(tt.tokens, start, start.Add(tt.elapsed), limit)
+			if !approxEqual(tokens, tt.wantTokens) {
+				t.Errorf("take() tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			if got.Allowed != tt.want.Allowed || got.Remaining != tt.want.Remaining ||
+				!approxDuration(got.Reset, tt.want.Reset) || !approxDuration(got.RetryAfter, tt.want.RetryAfter) {
+				t.Errorf("take() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Hour}
+	ctx := context.Background()
+
+	for i, wantAllowed := range []bool{true, true, false} {
+		result, err := store.Take(ctx, "a", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != wantAllowed {
+			t.Errorf("request %d: Allowed = %v, want %v", i+1, result.Allowed, wantAllowed)
+		}
+	}
+
+	// Buckets are per key
+	result, err := store.Take(ctx, "b", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed || result.Remaining != 1 {
+		t.Errorf("other key: %+v, want an allowed request with 1 remaining", result)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "10/1m", want: Limit{Requests: 10, Period: time.Minute}},
+		{in: " 60/30s ", want: Limit{Requests: 60, Period: 30 * time.Second}},
+		{in: "off", want: Limit{}},
+		{in: "0", want: Limit{}},
+		{in: "10", wantErr: true},
+		{in: "ten/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "10/soon", wantErr: true},
+		{in: "10/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	const epsilon = 1e-9
+	return a-b < epsilon && b-a < epsilon
+}
+
+func approxDuration(a, b time.Duration) bool {
+	d := a - b
+	return d < time.Millisecond && d > -time.Millisecond
+}
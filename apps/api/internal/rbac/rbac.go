@@ -0,0 +1,83 @@
+package rbac
+
+import "blog/api/internal/models"
+
+type Permission string
+
+const (
+	CreatePosts   Permission = "posts:create"
+	PublishPosts  Permission = "posts:publish"
+	EditAnyPost   Permission = "posts:edit-any"
+	DeleteAnyPost Permission = "posts:delete-any"
+	EditAbout     Permission = "about:edit"
+	UploadMedia   Permission = "media:upload"
+	ManageMedia   Permission = "media:manage"
+	ManageUsers   Permission = "users:manage"
+	ViewAuditLog  Permission = "audit:view"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleOwner: {
+		CreatePosts, PublishPosts, EditAnyPost, DeleteAnyPost,
+		EditAbout, UploadMedia, ManageMedia, ManageUsers, ViewAuditLog,
+	},
+	models.RoleEditor: {
+		CreatePosts, PublishPosts, EditAnyPost, DeleteAnyPost,
+		EditAbout, UploadMedia, ManageMedia,
+	},
+	models.RoleAuthor: {
+		CreatePosts, PublishPosts, UploadMedia,
+	},
+	models.RoleContributor: {
+		CreatePosts, UploadMedia,
+	},
+}
+
+// Can reports whether role grants permission. Unknown roles grant nothing.
+func Can(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by role.
+func Permissions(role string) []Permission {
+	return append([]Permission{}, rolePermissions[role]...)
+}
+
+// Scope limits what a personal access token may do on top of its owner's
+// role. Every scope allows reading; write scopes grant the permissions below.
+type Scope string
+
+const (
+	ScopeRead         Scope = "read"
+	ScopePostsWrite   Scope = "posts:write"
+	ScopeUploadsWrite Scope = "uploads:write"
+)
+
+var scopePermissions = map[Scope][]Permission{
+	ScopeRead:         {},
+	ScopePostsWrite:   {CreatePosts, PublishPosts, EditAnyPost, DeleteAnyPost},
+	ScopeUploadsWrite: {UploadMedia},
+}
+
+// ValidScope reports whether scope is a known scope.
+func ValidScope(scope string) bool {
+	_, ok := scopePermissions[Scope(scope)]
+	return ok
+}
+
+// ScopesGrant reports whether any of scopes grants permission.
+func ScopesGrant(scopes []string, permission Permission) bool {
+	for _, scope := range scopes {
+		for _, p := range scopePermissions[Scope(scope)] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package rbac
+
+import (
+	"blog/api/internal/models"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	all := []Permission{
+		CreatePosts, PublishPosts, EditAnyPost, DeleteAnyPost,
+		EditAbout, UploadMedia, ManageMedia, ManageUsers, ViewAuditLog,
+	}
+
+	granted := map[string][]Permission{
+		models.RoleOwner:       all,
+		models.RoleEditor:      {CreatePosts, PublishPosts, EditAnyPost, DeleteAnyPost, EditAbout, UploadMedia, ManageMedia},
+		models.RoleAuthor:      {CreatePosts, PublishPosts, UploadMedia},
+		models.RoleContributor: {CreatePosts, UploadMedia},
+		"":                     {},
+		"admin":                {},
+	}
+
+	for role, permissions := range granted {
+		want := map[Permission]bool{}
+		for _, p := range permissions {
+			want[p] = true
+		}
+		for _, p := range all {
+			if got := Can(role, p); got != want[p] {
+				t.Errorf("Can(%q, %s) = %v, want %v", role, p, got, want[p])
+			}
+		}
+	}
+}
+
+func TestScopesGrant(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		permission Permission
+		want       bool
+	}{
+		{"no scopes", nil, CreatePosts, false},
+		{"read only", []string{"read"}, CreatePosts, false},
+		{"posts:write creates posts", []string{"posts:write"}, CreatePosts, true},
+		{"posts:write edits any post", []string{"posts:write"}, EditAnyPost, true},
+		{"posts:write does not upload", []string{"posts:write"}, UploadMedia, false},
+		{"uploads:write uploads", []string{"uploads:write"}, UploadMedia, true},
+		{"uploads:write does not manage media", []string{"uploads:write"}, ManageMedia, false},
+		{"any matching scope", []string{"read", "uploads:write"}, UploadMedia, true},
+		{"no scope manages users", []string{"read", "posts:write", "uploads:write"}, ManageUsers, false},
+		{"unknown scope", []string{"admin"}, ManageUsers, false},
+	}
+	for _, tt := range tests {
+		if got := ScopesGrant(tt.scopes, tt.permission); got != tt.want {
+			t.Errorf("%s: ScopesGrant(%v, %s) = %v, want %v", tt.name, tt.scopes, tt.permission, got, tt.want)
+		}
+	}
+}
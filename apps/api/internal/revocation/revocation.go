@@ -0,0 +1,210 @@
+package revocation
+
+import (
+	"blog/api/internal/firebase"
+	"blog/api/internal/models"
+	"blog/api/pkg/utils"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	pruneInterval = time.Minute
+	retryInterval = 5 * time.Second
+	saveTimeout   = 10 * time.Second
+)
+
+// List keeps the access token revocation list in memory so AuthMiddleware
+// can check it on every request. Revocations are persisted in Firestore and
+// every instance watches the collection, so a revocation made on one instance
+// takes effect on all of them.
+type List struct {
+	firebase *firebase.Firebase
+	mu       sync.RWMutex
+	entries  map[string]models.Revocation
+}
+
+func NewList(fb *firebase.Firebase) *List {
+	return &List{
+		firebase: fb,
+		entries:  make(map[string]models.Revocation),
+	}
+}
+
+// Start loads the current revocations and keeps the cache in sync until ctx
+// is cancelled. It returns once the initial load has finished.
+func (l *List) Start(ctx context.Context) error {
+	it := l.firebase.WatchRevocations(ctx, time.Now())
+	if err := l.apply(it); err != nil {
+		it.Stop()
+		return err
+	}
+
+	go l.watch(ctx, it)
+	go l.prune(ctx)
+	return nil
+}
+
+// RevokeToken revokes a single access token.
+func (l *List) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return l.revoke(ctx, models.Revocation{
+		Kind:      models.RevokedToken,
+		Subject:   tokenID,
+		RevokedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RevokeSession revokes every token issued for a session. The entry is kept
+// as long as any of them, refresh tokens included, could still be valid.
+func (l *List) RevokeSession(ctx context.Context, sessionID string) error {
+	now := time.Now()
+	return l.revoke(ctx, models.Revocation{
+		Kind:      models.RevokedSession,
+		Subject:   sessionID,
+		RevokedAt: now,
+		ExpiresAt: now.Add(utils.RefreshTokenTTL),
+	})
+}
+
+// RevokeUser revokes every token issued to a user so far, for as long as any
+// of them could still be valid.
+func (l *List) RevokeUser(ctx context.Context, userID string) error {
+	now := time.Now()
+	return l.revoke(ctx, models.Revocation{
+		Kind:      models.RevokedUser,
+		Subject:   userID,
+		RevokedAt: now,
+		ExpiresAt: now.Add(utils.RefreshTokenTTL),
+	})
+}
+
+// IsRevoked reports whether the access token with the given claims has been
+// revoked.
+func (l *List) IsRevoked(claims *utils.JWTClaims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if claims.ID != "" {
+		if _, ok := l.entries[key(models.RevokedToken, claims.ID)]; ok {
+			return true
+		}
+	}
+
+	if claims.SessionID != "" {
+		if _, ok := l.entries[key(models.RevokedSession, claims.SessionID)]; ok {
+			return true
+		}
+	}
+
+	if entry, ok := l.entries[key(models.RevokedUser, claims.UserID)]; ok {
+		// iat has second precision, so a token issued in the same second as
+		// the revocation is treated as revoked
+		if claims.IssuedAt == nil || !claims.IssuedAt.Time.After(entry.RevokedAt.Truncate(time.Second)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revoke takes effect locally even if persisting fails, so at least this
+// instance stops accepting the token. Persisting is not cancelled with ctx,
+// so a client that disconnects cannot leave the other instances unaware.
+func (l *List) revoke(ctx context.Context, revocation models.Revocation) error {
+	l.add(revocation)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+	defer cancel()
+	return l.firebase.SaveRevocation(ctx, revocation)
+}
+
+func (l *List) add(revocation models.Revocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := key(revocation.Kind, revocation.Subject)
+	if existing, ok := l.entries[k]; ok && existing.RevokedAt.After(revocation.RevokedAt) {
+		return
+	}
+	l.entries[k] = revocation
+}
+
+func (l *List) apply(it *firestore.QuerySnapshotIterator) error {
+	snapshot, err := it.Next()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range snapshot.Changes {
+		if change.Kind == firestore.DocumentRemoved {
+			continue
+		}
+		var revocation models.Revocation
+		if err := change.Doc.DataTo(&revocation); err != nil {
+			slog.Warn("Skipping malformed revocation", "id", change.Doc.Ref.ID, "error", err)
+			continue
+		}
+		l.add(revocation)
+	}
+
+	return nil
+}
+
+func (l *List) watch(ctx context.Context, it *firestore.QuerySnapshotIterator) {
+	for {
+		for {
+			if err := l.apply(it); err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Revocation watch stopped", "error", err)
+				}
+				break
+			}
+		}
+		it.Stop()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+
+		// Resume with everything still in effect; entries already cached are
+		// simply re-added
+		it = l.firebase.WatchRevocations(ctx, time.Now())
+	}
+}
+
+// prune drops expired entries from the cache and from Firestore.
+func (l *List) prune(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			l.mu.Lock()
+			for k, entry := range l.entries {
+				if !entry.ExpiresAt.After(now) {
+					delete(l.entries, k)
+				}
+			}
+			l.mu.Unlock()
+
+			if _, err := l.firebase.DeleteExpiredRevocations(ctx); err != nil {
+				slog.Error("Failed to delete expired revocations", "error", err)
+			}
+		}
+	}
+}
+
+func key(kind, subject string) string {
+	return kind + ":" + subject
+}
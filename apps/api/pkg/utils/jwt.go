@@ -1,53 +1,354 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type JWTClaims struct {
 	UserID string `json:"sub"`
 	Email  string `json:"email"`
+	Role   string `json:"role,omitempty"`
+	// SessionID identifies the login session; refresh tokens rotated from the
+	// same login share it
+	SessionID string `json:"sid,omitempty"`
+	// Type tells access and refresh tokens apart; both are signed with the
+	// same keys
+	Type string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userID, email, secret string) (string, error) {
-	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
+// Token types carried in the typ claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+	MFATokenTTL     = 5 * time.Minute
+)
+
+// Every token names the service it is meant for in its audience, so no kind
+// can be used in place of another. Other services verifying access tokens
+// against the JWKS must require AccessTokenAudience and the issuer.
+const (
+	AccessTokenAudience  = "blog-api"
+	refreshTokenAudience = "blog-api:refresh"
+	mfaAudience          = "mfa"
+)
+
+const minRSAKeyBits = 2048
+
+var ErrNoSigningKey = errors.New("no JWT signing key is active")
+
+// KeyConfig is one entry of the JWT_KEYS manifest. A key with only a public
+// key is kept for verification after it has been retired from signing.
+type KeyConfig struct {
+	KeyID      string    `json:"kid"`
+	PrivateKey string    `json:"privateKey"`
+	PublicKey  string    `json:"publicKey"`
+	ActivateAt time.Time `json:"activateAt"`
+}
+
+type signingKey struct {
+	id         string
+	method     jwt.SigningMethod
+	private    crypto.Signer
+	public     crypto.PublicKey
+	activateAt time.Time
+}
+
+// KeySet holds the keys tokens are signed and verified with. The newest
+// active key signs; every key in the set verifies, so tokens signed before a
+// rotation stay valid until they expire. Keys with a future activateAt are
+// published in the JWKS ahead of time so verifiers can cache them.
+type KeySet struct {
+	keys []signingKey
+	// issuer is set as iss on every token and required when verifying
+	issuer string
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseKeySet parses a JSON array of KeyConfig. Ed25519 keys sign with EdDSA
+// and RSA keys with RS256. Tokens are issued as issuer.
+func ParseKeySet(manifest, issuer string) (*KeySet, error) {
+	if manifest == "" {
+		return nil, errors.New("JWT_KEYS is not set")
+	}
+
+	var configs []KeyConfig
+	if err := json.Unmarshal([]byte(manifest), &configs); err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEYS: %w", err)
+	}
+
+	if issuer == "" {
+		return nil, errors.New("JWT issuer is not set")
+	}
+
+	ks := &KeySet{issuer: issuer}
+	seen := map[string]bool{}
+	for _, cfg := range configs {
+		if cfg.KeyID == "" {
+			return nil, errors.New("JWT key without kid")
+		}
+		if seen[cfg.KeyID] {
+			return nil, fmt.Errorf("duplicate JWT key %q", cfg.KeyID)
+		}
+		seen[cfg.KeyID] = true
+
+		key, err := parseKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", cfg.KeyID, err)
+		}
+		ks.keys = append(ks.keys, key)
+	}
+
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].activateAt.Before(ks.keys[j].activateAt)
+	})
+
+	if _, err := ks.current(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+func parseKey(cfg KeyConfig) (signingKey, error) {
+	key := signingKey{id: cfg.KeyID, activateAt: cfg.ActivateAt}
+
+	switch {
+	case cfg.PrivateKey != "":
+		block, _ := pem.Decode([]byte(cfg.PrivateKey))
+		if block == nil {
+			return key, errors.New("private key is not PEM encoded")
+		}
+		var parsed any
+		var err error
+		if block.Type == "RSA PRIVATE KEY" {
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		} else {
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return key, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return key, errors.New("unsupported private key type")
+		}
+		key.private = signer
+		key.public = signer.Public()
+	case cfg.PublicKey != "":
+		block, _ := pem.Decode([]byte(cfg.PublicKey))
+		if block == nil {
+			return key, errors.New("public key is not PEM encoded")
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return key, err
+		}
+		key.public = parsed
+	default:
+		return key, errors.New("privateKey or publicKey is required")
+	}
+
+	switch public := key.public.(type) {
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return key, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	default:
+		return key, errors.New("only Ed25519 and RSA keys are supported")
+	}
+
+	return key, nil
+}
+
+// current returns the newest key that has a private key and is active.
+func (ks *KeySet) current() (*signingKey, error) {
+	now := time.Now()
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		key := &ks.keys[i]
+		if key.private != nil && !key.activateAt.After(now) {
+			return key, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+func (ks *KeySet) find(kid string) *signingKey {
+	for i := range ks.keys {
+		if ks.keys[i].id == kid {
+			return &ks.keys[i]
+		}
+	}
+	return nil
+}
+
+func (ks *KeySet) sign(claims JWTClaims) (string, error) {
+	key, err := ks.current()
+	if err != nil {
+		return "", err
+	}
+	claims.Issuer = ks.issuer
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// Issuer returns the iss claim of the tokens signed with the set.
+func (ks *KeySet) Issuer() string {
+	return ks.issuer
+}
+
+// JWKS returns the public keys in JSON Web Key Set format.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{
+			KeyID:     key.id,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func GenerateAccessToken(userID, email, role, sessionID string, keys *KeySet) (string, error) {
+	return keys.sign(JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		Type:      TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-	}
+	})
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+func GenerateRefreshToken(userID, email, sessionID, tokenID string, keys *KeySet) (string, error) {
+	return keys.sign(JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		Type:      TokenTypeRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Audience:  jwt.ClaimStrings{refreshTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
 }
 
-func GenerateRefreshToken(userID, email, secret string) (string, error) {
-	claims := JWTClaims{
+// GenerateMFAToken issues the challenge token a user exchanges for real tokens
+// by passing the second factor.
+func GenerateMFAToken(userID, email string, keys *KeySet) (string, error) {
+	return keys.sign(JWTClaims{
 		UserID: userID,
 		Email:  email,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFATokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-	}
+	})
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// ValidateAccessToken validates a token presented as a bearer token.
+func ValidateAccessToken(tokenString string, keys *KeySet) (*JWTClaims, error) {
+	return parseAs(tokenString, keys, TokenTypeAccess, AccessTokenAudience)
 }
 
-func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
+// ValidateRefreshToken validates a token presented for rotation. Access
+// tokens are rejected here, before their jti could be mistaken for a reused
+// refresh token.
+func ValidateRefreshToken(tokenString string, keys *KeySet) (*JWTClaims, error) {
+	return parseAs(tokenString, keys, TokenTypeRefresh, refreshTokenAudience)
+}
+
+func ValidateMFAToken(tokenString string, keys *KeySet) (*JWTClaims, error) {
+	return parseToken(tokenString, keys, jwt.WithAudience(mfaAudience))
+}
+
+// parseAs validates a token of the given type and audience.
+func parseAs(tokenString string, keys *KeySet, typ, audience string) (*JWTClaims, error) {
+	claims, err := parseToken(tokenString, keys, jwt.WithAudience(audience))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != typ {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+func parseToken(tokenString string, keys *KeySet, opts ...jwt.ParserOption) (*JWTClaims, error) {
+	opts = append(opts,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(keys.issuer),
+	)
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key := keys.find(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
-	})
+		return key.public, nil
+	}, opts...)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// SignPath returns the hex HMAC-SHA256 signature of a path valid until expires
+func SignPath(path string, expires time.Time, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyPathSignature checks a signature produced by SignPath and that it has
+// not expired. expires is the Unix timestamp that was signed.
+func VerifyPathSignature(path, expires, signature, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+	if time.Now().After(expiresAt) {
+		return false
+	}
+
+	expected, err := hex.DecodeString(SignPath(path, expiresAt, secret))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
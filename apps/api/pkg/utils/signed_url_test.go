@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyPathSignature(t *testing.T) {
+	const (
+		secret = "test-secret"
+		path   = "/media/file/0123456789abcdef01234567"
+	)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	expiresParam := strconv.FormatInt(expires.Unix(), 10)
+	signature := SignPath(path, expires, secret)
+
+	expired := time.Now().Add(-time.Minute).Truncate(time.Second)
+	expiredParam := strconv.FormatInt(expired.Unix(), 10)
+	expiredSignature := SignPath(path, expired, secret)
+
+	tests := []struct {
+		name      string
+		path      string
+		expires   string
+		signature string
+		secret    string
+		want      bool
+	}{
+		{"valid", path, expiresParam, signature, secret, true},
+		{"expired", path, expiredParam, expiredSignature, secret, false},
+		{"other path", path + "0", expiresParam, signature, secret, false},
+		{"extended expiry", path, strconv.FormatInt(expires.Unix()+3600, 10), signature, secret, false},
+		{"tampered signature", path, expiresParam, "00" + signature[2:], secret, false},
+		{"truncated signature", path, expiresParam, signature[:32], secret, false},
+		{"non-hex signature", path, expiresParam, "zz" + signature[2:], secret, false},
+		{"missing signature", path, expiresParam, "", secret, false},
+		{"non-numeric expiry", path, "tomorrow", signature, secret, false},
+		{"other secret", path, expiresParam, signature, "other-secret", false},
+		{"no secret configured", path, expiresParam, SignPath(path, expires, ""), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPathSignature(tt.path, tt.expires, tt.signature, tt.secret); got != tt.want {
+				t.Errorf("VerifyPathSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed from RFC 6238 appendix B, "12345678901234567890", base32
+// encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCodeRFC6238 checks the RFC 6238 SHA-1 test vectors. The RFC lists
+// 8-digit codes; 6-digit codes are their last six digits.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step := tt.unix / int64(totpPeriod.Seconds())
+		if got := totpCode(key, step); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / int64(totpPeriod.Seconds())
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       time.Time
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, "050471", now, 0, step, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", now, 0, step, true},
+		{"previous step within skew", rfc6238Secret, "050471", now.Add(totpPeriod), 0, step, true},
+		{"next step within skew", rfc6238Secret, "050471", now.Add(-totpPeriod), 0, step, true},
+		{"outside skew", rfc6238Secret, "050471", now.Add(2 * totpPeriod), 0, 0, false},
+		{"replayed code", rfc6238Secret, "050471", now, step, 0, false},
+		{"code older than last step", rfc6238Secret, "050471", now.Add(totpPeriod), step + 1, 0, false},
+		{"wrong code", rfc6238Secret, "050472", now, 0, 0, false},
+		{"wrong length", rfc6238Secret, "50471", now, 0, 0, false},
+		{"invalid secret", "not base32!", "050471", now, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := ValidateTOTP(tt.secret, tt.code, tt.at, tt.lastStep)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = (%d, %v), want (%d, %v)", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"k7qm-x2pa-9fzt", "k7qmx2pa9fzt"},
+		{" K7QM-X2PA-9FZT ", "k7qmx2pa9fzt"},
+		{"k7qm x2pa 9fzt", "k7qmx2pa9fzt"},
+		{"k7qmx2pa9fzt", "k7qmx2pa9fzt"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.code); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
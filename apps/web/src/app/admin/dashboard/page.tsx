@@ -6,7 +6,7 @@ import { useAtomValue } from 'jotai'
 import { useQuery } from '@tanstack/react-query'
 import Link from 'next/link'
 import { userAtom } from '@/store/auth'
-import { authApi, BlogPost } from '@/lib/api'
+import { authApi, BlogPost, clearSession } from '@/lib/api'
 import { postQueries } from '@/lib/queries'
 import { Button } from '@/components/common/Button'
 import styles from './page.module.scss'
@@ -30,8 +30,7 @@ export default function AdminDashboard() {
     try {
       await authApi.logout()
       if (typeof window !== 'undefined') {
-        localStorage.removeItem('accessToken')
-        localStorage.removeItem('refreshToken')
+        clearSession()
       }
       router.push('/')
     } catch (error) {
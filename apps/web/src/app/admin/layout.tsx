@@ -7,6 +7,7 @@ import { useAtomValue, useSetAtom } from 'jotai'
 import { useQuery } from '@tanstack/react-query'
 import { userAtom } from '@/store/auth'
 import { authQueries } from '@/lib/queries'
+import { hasSession } from '@/lib/api'
 
 export default function AdminLayout({
   children,
@@ -20,10 +21,7 @@ export default function AdminLayout({
 
   const { data: meData } = useQuery({
     ...authQueries.me(),
-    enabled:
-      !isLoginPage &&
-      typeof window !== 'undefined' &&
-      !!localStorage.getItem('accessToken'),
+    enabled: !isLoginPage && hasSession(),
   })
 
   useEffect(() => {
@@ -34,8 +32,7 @@ export default function AdminLayout({
 
   useEffect(() => {
     if (typeof window !== 'undefined' && !isLoginPage) {
-      const token = localStorage.getItem('accessToken')
-      if (!token && !user) {
+      if (!hasSession() && !user) {
         window.location.href = '/admin/login'
       }
     }
@@ -5,7 +5,7 @@ import { useRouter } from 'next/navigation'
 import Link from 'next/link'
 import { useSetAtom } from 'jotai'
 import { useMutation } from '@tanstack/react-query'
-import { authApi } from '@/lib/api'
+import { authApi, storeSession } from '@/lib/api'
 import { userAtom } from '@/store/auth'
 import { Button } from '@/components/common/Button'
 import styles from './page.module.scss'
@@ -28,12 +28,21 @@ export default function AdminLoginPage() {
   const [isLoading, setIsLoading] = useState(false)
 
   const loginMutation = useMutation({
-    mutationFn: authApi.loginWithGoogle,
-    onSuccess: (data) => {
-      if (typeof window !== 'undefined') {
-        localStorage.setItem('accessToken', data.accessToken)
-        localStorage.setItem('refreshToken', data.refreshToken)
+    mutationFn: async (credentials: { token: string; inviteToken?: string }) => {
+      const data = await authApi.loginWithGoogle(credentials)
+      if (!data.mfaRequired) {
+        return data
+      }
+
+      // Accounts with two-factor authentication need a code to finish
+      const code = window.prompt('Enter the code from your authenticator app, or a recovery code')
+      if (!code) {
+        throw new Error('Two-factor authentication cancelled')
       }
+      return authApi.verifyMfa({ mfaToken: data.mfaToken, code: code.trim() })
+    },
+    onSuccess: (data) => {
+      storeSession(data)
       setUser(data.user)
       router.push('/admin/dashboard')
     },
@@ -56,7 +65,9 @@ export default function AdminLoginPage() {
       scope: 'email profile',
       callback: (response: any) => {
         if (response.access_token) {
-          loginMutation.mutate(response.access_token)
+          // Invite links carry a single-use token that creates the account
+          const inviteToken = new URLSearchParams(window.location.search).get('invite') ?? undefined
+          loginMutation.mutate({ token: response.access_token, inviteToken })
         } else {
           setIsLoading(false)
         }
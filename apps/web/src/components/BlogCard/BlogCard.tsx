@@ -14,7 +14,10 @@ interface BlogCardProps {
 export const BlogCard: React.FC<BlogCardProps> = ({ post }) => {
   return (
     <Link href={`/posts/${post.id}`} className={styles.card}>
-      <div className={styles.imageWrapper}>
+      <div
+        className={styles.imageWrapper}
+        style={{ backgroundColor: post.cover?.dominantColor }}
+      >
         {post.imageUrl ? (
           <Image
             src={post.imageUrl}
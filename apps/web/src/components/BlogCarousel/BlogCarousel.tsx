@@ -54,6 +54,7 @@ export const BlogCarousel: React.FC<BlogCarouselProps> = ({ posts }) => {
             className={`${styles.slide} ${
               index === currentIndex ? styles.active : ''
             }`}
+            style={{ backgroundColor: post.cover?.dominantColor }}
           >
             {post.imageUrl ? (
               <Image
@@ -10,9 +10,43 @@ export const api = axios.create({
   },
 })
 
+// In cookie mode the API keeps the tokens in HttpOnly cookies; we only hold
+// the CSRF token, which must accompany every state-changing request.
+export const cookieAuth = process.env.NEXT_PUBLIC_AUTH_COOKIES === 'true'
+
+const CSRF_HEADER = 'X-CSRF-Token'
+
+// storeSession keeps whatever a login or refresh response carries.
+export const storeSession = (data: { accessToken?: string; refreshToken?: string; csrfToken?: string }) => {
+  if (typeof window === 'undefined') return
+  if (cookieAuth) {
+    localStorage.setItem('csrfToken', data.csrfToken ?? '')
+  } else {
+    localStorage.setItem('accessToken', data.accessToken ?? '')
+    localStorage.setItem('refreshToken', data.refreshToken ?? '')
+  }
+}
+
+export const clearSession = () => {
+  localStorage.removeItem('accessToken')
+  localStorage.removeItem('refreshToken')
+  localStorage.removeItem('csrfToken')
+}
+
+export const hasSession = () =>
+  typeof window !== 'undefined' && !!localStorage.getItem(cookieAuth ? 'csrfToken' : 'accessToken')
+
 // Request interceptor to add auth token
 api.interceptors.request.use((config) => {
   if (typeof window !== 'undefined') {
+    if (cookieAuth) {
+      const csrfToken = localStorage.getItem('csrfToken')
+      if (csrfToken) {
+        config.headers[CSRF_HEADER] = csrfToken
+      }
+      return config
+    }
+
     const token = localStorage.getItem('accessToken')
     if (token) {
       config.headers.Authorization = `Bearer ${token}`
@@ -21,6 +55,31 @@ api.interceptors.request.use((config) => {
   return config
 })
 
+// Refresh tokens are single use, so concurrent 401s must share one refresh
+// request instead of presenting the same token twice.
+let refreshPromise: Promise<string | undefined> | null = null
+
+const refreshAccessToken = () => {
+  if (!refreshPromise) {
+    const request = cookieAuth
+      ? axios.post(`${API_BASE_URL}/auth/refresh`, {}, {
+          withCredentials: true,
+          headers: { [CSRF_HEADER]: localStorage.getItem('csrfToken') ?? '' },
+        })
+      : axios.post(`${API_BASE_URL}/auth/refresh`, { refreshToken: localStorage.getItem('refreshToken') })
+
+    refreshPromise = request
+      .then((response) => {
+        storeSession(response.data)
+        return response.data.accessToken as string | undefined
+      })
+      .finally(() => {
+        refreshPromise = null
+      })
+  }
+  return refreshPromise
+}
+
 // Response interceptor to handle token refresh
 api.interceptors.response.use(
   (response) => response,
@@ -35,19 +94,18 @@ api.interceptors.response.use(
       originalRequest._retry = true
 
       try {
-        const refreshToken = localStorage.getItem('refreshToken')
-        if (refreshToken) {
-          const response = await axios.post(`${API_BASE_URL}/auth/refresh`, {
-            refreshToken,
-          })
-          const { accessToken } = response.data
-          localStorage.setItem('accessToken', accessToken)
-          originalRequest.headers.Authorization = `Bearer ${accessToken}`
+        if (hasSession()) {
+          const accessToken = await refreshAccessToken()
+          if (cookieAuth) {
+            // The retried request picks up the new CSRF token in the interceptor
+            delete originalRequest.headers[CSRF_HEADER]
+          } else {
+            originalRequest.headers.Authorization = `Bearer ${accessToken}`
+          }
           return api(originalRequest)
         }
       } catch (refreshError) {
-        localStorage.removeItem('accessToken')
-        localStorage.removeItem('refreshToken')
+        clearSession()
         window.location.href = '/'
         return Promise.reject(refreshError)
       }
@@ -57,12 +115,20 @@ api.interceptors.response.use(
   },
 )
 
+export interface ImagePlaceholder {
+  blurHash: string
+  dominantColor: string
+  width: number
+  height: number
+}
+
 export interface BlogPost {
   id: string
   title: string
   content: string
   summary: string
   imageUrl: string
+  cover?: ImagePlaceholder
   published: boolean
   tags: string[]
   readingTime?: number // in minutes
@@ -165,8 +231,33 @@ export const blogApi = {
 }
 
 export const authApi = {
-  loginWithGoogle: async (token: string) => {
-    const response = await api.post('/auth/google', { token })
+  loginWithGoogle: async ({ token, inviteToken }: { token: string; inviteToken?: string }) => {
+    const response = await api.post('/auth/google', { token, inviteToken })
+    return response.data
+  },
+
+  verifyMfa: async ({ mfaToken, code }: { mfaToken: string; code: string }) => {
+    const response = await api.post('/auth/mfa/verify', { mfaToken, code })
+    return response.data
+  },
+
+  getLoginProviders: async () => {
+    const response = await api.get('/auth/providers')
+    return response.data
+  },
+
+  loginWithProvider: async ({
+    provider,
+    ...credential
+  }: {
+    provider: string
+    token?: string
+    code?: string
+    redirectUri?: string
+    codeVerifier?: string
+    inviteToken?: string
+  }) => {
+    const response = await api.post(`/auth/login/${encodeURIComponent(provider)}`, credential)
     return response.data
   },
 
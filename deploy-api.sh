@@ -170,13 +170,13 @@ main() {
   echo "1. Set environment variables in Cloud Run:"
   echo "   gcloud run services update $SERVICE_NAME --region=$REGION \\"
   echo "     --set-env-vars=\"MONGODB_URI=your-mongodb-uri\" \\"
-  echo "     --set-env-vars=\"JWT_SECRET=your-jwt-secret\" \\"
   echo "     --set-env-vars=\"FRONTEND_URL=your-frontend-url\""
   echo ""
   echo "2. Or use Secret Manager for sensitive values:"
   echo "   gcloud secrets create mongodb-uri --data-file=-"
+  echo "   gcloud secrets create jwt-keys --data-file=jwt-keys.json"
   echo "   gcloud run services update $SERVICE_NAME --region=$REGION \\"
-  echo "     --set-secrets=\"MONGODB_URI=mongodb-uri:latest\""
+  echo "     --set-secrets=\"MONGODB_URI=mongodb-uri:latest,JWT_KEYS=jwt-keys:latest\""
   echo ""
 }
 